@@ -8,18 +8,26 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	mrand "math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/nbd-wtf/go-nostr"
 	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/pion/turn/v2"
 	"github.com/pion/webrtc/v3"
 	qrcode "github.com/skip2/go-qrcode"
 	"golang.org/x/crypto/nacl/box"
@@ -41,14 +49,25 @@ type TrustDiaryService struct {
 	nostrPubKey    string
 	trustedUsers   map[string]*TrustedUser
 	entries        []DiaryEntry
-	peerConnection *webrtc.PeerConnection
-	dataChannel    *webrtc.DataChannel
-	currentOffer   string
-	offerID        string
-	relays         []*nostr.Relay
+	connections    map[string]*Connection
+	peerConns      map[string]*webrtc.PeerConnection
+	dataChannels   map[string]*webrtc.DataChannel
+	offerPoolSize  int
+	replenishMu    sync.Mutex
+	offerEvents    map[string]string    // offer event ID -> offer ID
+	seenAnswers    map[string]time.Time // answer event ID -> first seen
+	plainAnswers   bool                 // accept unsigned SDP answers over HTTP
+	relays         *relayManager
 	mu             sync.RWMutex
 	dataDir        string
 	port           int
+	ice            ICEConfig
+	webrtcAPI      *webrtc.API
+	turnServer     *turn.Server
+	relayURLs      []string
+	relayListen    string
+	localRelay     *embeddedRelay
+	localRelayURL  string
 }
 
 type Identity struct {
@@ -64,6 +83,7 @@ type TrustedUser struct {
 	Name         string    `json:"name"`
 	Permissions  []string  `json:"permissions"`
 	TrustedAt    time.Time `json:"trustedAt"`
+	NostrPubKey  string    `json:"nostrPubKey,omitempty"` // hex key readers sign answers with
 }
 
 type DiaryEntry struct {
@@ -74,13 +94,20 @@ type DiaryEntry struct {
 }
 
 func NewTrustDiaryService(dataDir string, port int) *TrustDiaryService {
-	return &TrustDiaryService{
-		trustedUsers: make(map[string]*TrustedUser),
-		entries:      []DiaryEntry{},
-		dataDir:      dataDir,
-		port:         port,
-		relays:       make([]*nostr.Relay, 0),
+	s := &TrustDiaryService{
+		trustedUsers:  make(map[string]*TrustedUser),
+		entries:       []DiaryEntry{},
+		connections:   make(map[string]*Connection),
+		peerConns:     make(map[string]*webrtc.PeerConnection),
+		dataChannels:  make(map[string]*webrtc.DataChannel),
+		offerEvents:   make(map[string]string),
+		seenAnswers:   make(map[string]time.Time),
+		offerPoolSize: defaultOfferPoolSize,
+		dataDir:       dataDir,
+		port:          port,
 	}
+	s.relays = newRelayManager(s.answerFilters, s.handleNostrAnswer, s.republishOffer)
+	return s
 }
 
 func (s *TrustDiaryService) Initialize() error {
@@ -97,24 +124,38 @@ func (s *TrustDiaryService) Initialize() error {
 	// Generate Nostr keys from our Ed25519 identity
 	s.generateNostrKeys()
 
+	if err := s.loadTrustedUsers(); err != nil {
+		return err
+	}
+
+	// Start the embedded relay first so we can connect to it
+	if s.relayListen != "" {
+		if err := s.startEmbeddedRelay(s.relayListen); err != nil {
+			return err
+		}
+	}
+
 	// Connect to Nostr relays
 	if err := s.connectToNostrRelays(); err != nil {
 		log.Printf("Warning: Failed to connect to Nostr relays: %v", err)
 	}
 
-	// Create initial WebRTC offer
-	if err := s.createWebRTCOffer(); err != nil {
-		return fmt.Errorf("failed to create WebRTC offer: %w", err)
+	// Set up ICE and the embedded TURN relay
+	if err := s.setupICE(); err != nil {
+		return fmt.Errorf("failed to set up ICE: %w", err)
 	}
 
-	// Publish offer to Nostr
-	s.publishOfferToNostr()
+	// Fill the offer pool; each offer is published as it is created
+	if err := s.replenishOffers(); err != nil {
+		return fmt.Errorf("failed to create WebRTC offers: %w", err)
+	}
+	go s.maintainOffers()
 
 	log.Printf("✅ Service initialized")
 	log.Printf("📍 Admin UI: http://localhost:%d", s.port)
 	log.Printf("🔑 Service Public Key: %s...", base64.StdEncoding.EncodeToString(s.identity.PublicKey)[:32])
 	log.Printf("⚡ Nostr Public Key: %s", s.nostrPubKey)
-	log.Printf("📡 Connected to %d Nostr relays", len(s.relays))
+	log.Printf("📡 Using %d Nostr relays", len(s.relays.Status()))
 
 	return nil
 }
@@ -168,131 +209,1332 @@ func (s *TrustDiaryService) loadOrGenerateIdentity() error {
 		BoxPrivateKey: *boxPriv,
 	}
 
-	// Save identity
-	stored := map[string]string{
-		"publicKey":     base64.StdEncoding.EncodeToString(pub),
-		"privateKey":    base64.StdEncoding.EncodeToString(priv),
-		"boxPublicKey":  base64.StdEncoding.EncodeToString(boxPub[:]),
-		"boxPrivateKey": base64.StdEncoding.EncodeToString(boxPriv[:]),
-		"createdAt":     time.Now().Format(time.RFC3339),
+	// Save identity
+	stored := map[string]string{
+		"publicKey":     base64.StdEncoding.EncodeToString(pub),
+		"privateKey":    base64.StdEncoding.EncodeToString(priv),
+		"boxPublicKey":  base64.StdEncoding.EncodeToString(boxPub[:]),
+		"boxPrivateKey": base64.StdEncoding.EncodeToString(boxPriv[:]),
+		"createdAt":     time.Now().Format(time.RFC3339),
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity: %w", err)
+	}
+
+	if err := os.WriteFile(identityPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save identity: %w", err)
+	}
+
+	log.Println("🔐 Generated new identity")
+	return nil
+}
+
+// loadTrustedUsers reads trusted.json from the data dir; only readers listed
+// there with a nostrPubKey can answer offers over Nostr
+func (s *TrustDiaryService) loadTrustedUsers() error {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "trusted.json"))
+	if os.IsNotExist(err) {
+		log.Println("📋 No trusted.json, Nostr answers will be ignored until a reader is added with POST /api/trusted")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read trusted users: %w", err)
+	}
+
+	var users []TrustedUser
+	if err := json.Unmarshal(data, &users); err != nil {
+		return fmt.Errorf("failed to parse trusted users: %w", err)
+	}
+
+	for i := range users {
+		s.trustedUsers[users[i].key()] = &users[i]
+	}
+	log.Printf("📋 Loaded %d trusted users", len(users))
+	return nil
+}
+
+// key identifies a trusted user: by signing key, or by Nostr key for readers
+// registered only to answer offers
+func (u *TrustedUser) key() string {
+	if u.PublicKey != "" {
+		return u.PublicKey
+	}
+	return "nostr:" + u.NostrPubKey
+}
+
+// saveTrustedUsersLocked writes trusted.json; the caller holds s.mu
+func (s *TrustDiaryService) saveTrustedUsersLocked() error {
+	users := make([]TrustedUser, 0, len(s.trustedUsers))
+	for _, user := range s.trustedUsers {
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].TrustedAt.Before(users[j].TrustedAt) })
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dataDir, "trusted.json"), data, 0600)
+}
+
+// registerNostrKey lets a reader answer offers with nostrPubKey (hex or
+// npub). An existing user with publicKey gets the key added; otherwise a
+// new reader called name is trusted
+func (s *TrustDiaryService) registerNostrKey(name, publicKey, boxPublicKey, nostrPubKey string) (TrustedUser, error) {
+	if strings.HasPrefix(nostrPubKey, "npub") {
+		prefix, value, err := nip19.Decode(nostrPubKey)
+		if err != nil || prefix != "npub" {
+			return TrustedUser{}, errors.New("invalid npub")
+		}
+		nostrPubKey, _ = value.(string)
+	}
+	if !nostr.IsValidPublicKeyHex(nostrPubKey) {
+		return TrustedUser{}, errors.New("nostrPubKey must be 64 hex characters or an npub")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.trustedUsers {
+		if user.NostrPubKey == nostrPubKey && (publicKey == "" || user.PublicKey != publicKey) {
+			return TrustedUser{}, errNostrKeyTaken
+		}
+	}
+
+	// Readers look users up without holding s.mu, so swap in a new value
+	// rather than changing the one in the map
+	var user TrustedUser
+	if existing := s.trustedUsers[publicKey]; publicKey != "" && existing != nil {
+		user = *existing
+	} else {
+		if name == "" {
+			return TrustedUser{}, errors.New("name is required for a new reader")
+		}
+		user = TrustedUser{
+			PublicKey:    publicKey,
+			BoxPublicKey: boxPublicKey,
+			Name:         name,
+			Permissions:  []string{"read"},
+			TrustedAt:    time.Now(),
+		}
+	}
+	user.NostrPubKey = nostrPubKey
+	s.trustedUsers[user.key()] = &user
+
+	if err := s.saveTrustedUsersLocked(); err != nil {
+		return user, fmt.Errorf("failed to save trusted users: %w", err)
+	}
+	return user, nil
+}
+
+// readerByNostrKey finds the trusted user who signs with a Nostr key
+func (s *TrustDiaryService) readerByNostrKey(pubKey string) *TrustedUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.trustedUsers {
+		if user.NostrPubKey != "" && user.NostrPubKey == pubKey {
+			return user
+		}
+	}
+	return nil
+}
+
+func (s *TrustDiaryService) generateNostrKeys() {
+	// Generate Nostr keys from our Ed25519 identity
+	// Nostr uses secp256k1, but we'll derive it from our Ed25519 seed
+	hash := sha256.Sum256(s.identity.PrivateKey.Seed())
+	s.nostrPrivKey = hex.EncodeToString(hash[:])
+
+	// Get public key from private key
+
+	pk, _ := nostr.GetPublicKey(s.nostrPrivKey)
+	s.nostrPubKey = pk
+}
+
+// nostrRelayURLs lists the relays to use: the embedded relay when it runs,
+// then NOSTR_RELAYS, or the public defaults if neither is set
+func (s *TrustDiaryService) nostrRelayURLs() []string {
+	urls := s.relayURLs
+	if urls == nil && s.localRelay == nil {
+		urls = defaultRelays
+	}
+	if s.localRelayURL != "" {
+		urls = append([]string{s.localRelayURL}, urls...)
+	}
+	return urls
+}
+
+func (s *TrustDiaryService) connectToNostrRelays() error {
+	added := 0
+	for _, url := range s.nostrRelayURLs() {
+		if err := s.relays.Add(url); err != nil {
+			log.Printf("Failed to add relay %s: %v", url, err)
+			continue
+		}
+		added++
+	}
+
+	if added == 0 {
+		return fmt.Errorf("no usable Nostr relay configured")
+	}
+	return nil
+}
+
+// answerFilters is what each relay subscription asks for; it is rebuilt on
+// every (re)subscribe. Answers are addressed to the service with a p tag, so
+// anything older than an offer's lifetime cannot match a live offer
+func (s *TrustDiaryService) answerFilters() nostr.Filters {
+	since := nostr.Timestamp(time.Now().Add(-offerTTL).Unix())
+	return nostr.Filters{{
+		Kinds: []int{21001}, // Custom kind for WebRTC answers
+		Tags:  nostr.TagMap{"p": []string{s.nostrPubKey}},
+		Since: &since,
+	}}
+}
+
+const (
+	relayBackoffMin     = time.Second
+	relayBackoffMax     = 5 * time.Minute
+	relayConnectTimeout = 10 * time.Second
+	relayPublishTimeout = 10 * time.Second
+)
+
+var (
+	errRelayExists   = errors.New("relay already added")
+	errRelayNotFound = errors.New("relay not found")
+)
+
+// RelayStatus reports the health of one relay
+type RelayStatus struct {
+	URL            string     `json:"url"`
+	State          string     `json:"state"` // connecting, connected or waiting
+	ConnectedSince *time.Time `json:"connectedSince,omitempty"`
+	NextRetry      *time.Time `json:"nextRetry,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	LastErrorAt    *time.Time `json:"lastErrorAt,omitempty"`
+	Reconnects     int        `json:"reconnects"`
+	PublishOK      int        `json:"publishOk"`
+	PublishFailed  int        `json:"publishFailed"`
+	EventsReceived int        `json:"eventsReceived"`
+	LastLatencyMs  int64      `json:"lastLatencyMs,omitempty"`
+	AvgLatencyMs   int64      `json:"avgLatencyMs,omitempty"`
+}
+
+type managedRelay struct {
+	url    string
+	cancel context.CancelFunc
+
+	mu           sync.Mutex
+	relay        *nostr.Relay
+	status       RelayStatus
+	latencyTotal time.Duration
+}
+
+// relayManager keeps a connection and subscription open to each relay,
+// redialing with exponential backoff when one drops
+type relayManager struct {
+	mu        sync.RWMutex
+	relays    map[string]*managedRelay
+	filters   func() nostr.Filters
+	onEvent   func(*nostr.Event)
+	onConnect func(url string)
+}
+
+func newRelayManager(filters func() nostr.Filters, onEvent func(*nostr.Event), onConnect func(url string)) *relayManager {
+	return &relayManager{
+		relays:    make(map[string]*managedRelay),
+		filters:   filters,
+		onEvent:   onEvent,
+		onConnect: onConnect,
+	}
+}
+
+// Add starts managing a relay; the first connection attempt happens in the
+// background
+func (m *relayManager) Add(url string) error {
+	url = nostr.NormalizeURL(url)
+	if !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+		return fmt.Errorf("relay URL must be ws:// or wss://")
+	}
+
+	m.mu.Lock()
+	if _, exists := m.relays[url]; exists {
+		m.mu.Unlock()
+		return errRelayExists
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	mr := &managedRelay{
+		url:    url,
+		cancel: cancel,
+		status: RelayStatus{URL: url, State: "connecting"},
+	}
+	m.relays[url] = mr
+	m.mu.Unlock()
+
+	go m.run(ctx, mr)
+	return nil
+}
+
+// Remove stops managing a relay and closes its connection
+func (m *relayManager) Remove(url string) error {
+	url = nostr.NormalizeURL(url)
+
+	m.mu.Lock()
+	mr := m.relays[url]
+	delete(m.relays, url)
+	m.mu.Unlock()
+
+	if mr == nil {
+		return errRelayNotFound
+	}
+	mr.cancel()
+
+	mr.mu.Lock()
+	relay := mr.relay
+	mr.mu.Unlock()
+	if relay != nil {
+		relay.Close()
+	}
+	return nil
+}
+
+// run connects, subscribes and waits for the connection to end, then backs
+// off and tries again until the relay is removed
+func (m *relayManager) run(ctx context.Context, mr *managedRelay) {
+	backoff := relayBackoffMin
+	for {
+		wasConnected, err := m.session(ctx, mr)
+		if ctx.Err() != nil {
+			return
+		}
+		if wasConnected {
+			backoff = relayBackoffMin
+		}
+
+		// Up to 50% jitter so relays that dropped together do not redial
+		// in lockstep
+		wait := backoff + time.Duration(mrand.Int63n(int64(backoff)/2+1))
+		retry := time.Now().Add(wait)
+
+		mr.mu.Lock()
+		now := time.Now()
+		mr.status.State = "waiting"
+		mr.status.ConnectedSince = nil
+		mr.status.NextRetry = &retry
+		mr.status.LastError = err.Error()
+		mr.status.LastErrorAt = &now
+		if wasConnected {
+			mr.status.Reconnects++
+		}
+		mr.mu.Unlock()
+
+		log.Printf("Relay %s: %v (retrying in %s)", mr.url, err, wait.Round(time.Second))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		backoff *= 2
+		if backoff > relayBackoffMax {
+			backoff = relayBackoffMax
+		}
+		mr.mu.Lock()
+		mr.status.State = "connecting"
+		mr.status.NextRetry = nil
+		mr.mu.Unlock()
+	}
+}
+
+// session holds one connection open until it drops or ctx is cancelled
+func (m *relayManager) session(ctx context.Context, mr *managedRelay) (bool, error) {
+	connectCtx, cancel := context.WithTimeout(ctx, relayConnectTimeout)
+	relay, err := nostr.RelayConnect(connectCtx, mr.url)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	defer relay.Close()
+
+	sub, err := relay.Subscribe(ctx, m.filters())
+	if err != nil {
+		return false, fmt.Errorf("failed to subscribe: %w", err)
+	}
+
+	now := time.Now()
+	mr.mu.Lock()
+	mr.relay = relay
+	mr.status.State = "connected"
+	mr.status.ConnectedSince = &now
+	mr.mu.Unlock()
+
+	defer func() {
+		mr.mu.Lock()
+		mr.relay = nil
+		mr.mu.Unlock()
+	}()
+
+	log.Printf("✅ Connected to Nostr relay: %s", mr.url)
+	if m.onConnect != nil {
+		go m.onConnect(mr.url)
+	}
+
+	for {
+		select {
+		case ev, ok := <-sub.Events:
+			if !ok {
+				return true, errors.New("subscription closed")
+			}
+			mr.mu.Lock()
+			mr.status.EventsReceived++
+			mr.mu.Unlock()
+			m.onEvent(ev)
+		case <-relay.Context().Done():
+			return true, errors.New("connection lost")
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+// Publish sends ev to every connected relay in parallel and returns how
+// many accepted it
+func (m *relayManager) Publish(ev nostr.Event) int {
+	return m.publish(ev, "")
+}
+
+// PublishTo sends ev to a single relay
+func (m *relayManager) PublishTo(url string, ev nostr.Event) bool {
+	return m.publish(ev, url) == 1
+}
+
+func (m *relayManager) publish(ev nostr.Event, only string) int {
+	m.mu.RLock()
+	targets := make([]*managedRelay, 0, len(m.relays))
+	for url, mr := range m.relays {
+		if only == "" || url == only {
+			targets = append(targets, mr)
+		}
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	var accepted int32
+	for _, mr := range targets {
+		mr.mu.Lock()
+		relay := mr.relay
+		mr.mu.Unlock()
+		if relay == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(mr *managedRelay, relay *nostr.Relay) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), relayPublishTimeout)
+			start := time.Now()
+			status, err := relay.Publish(ctx, ev)
+			latency := time.Since(start)
+			cancel()
+
+			ok := status == nostr.PublishStatusSucceeded
+			if ok {
+				atomic.AddInt32(&accepted, 1)
+			} else if err == nil {
+				err = errors.New("no OK from relay")
+			}
+
+			mr.mu.Lock()
+			if ok {
+				mr.status.PublishOK++
+				mr.latencyTotal += latency
+				mr.status.LastLatencyMs = latency.Milliseconds()
+				mr.status.AvgLatencyMs = (mr.latencyTotal / time.Duration(mr.status.PublishOK)).Milliseconds()
+			} else {
+				now := time.Now()
+				mr.status.PublishFailed++
+				mr.status.LastError = err.Error()
+				mr.status.LastErrorAt = &now
+			}
+			mr.mu.Unlock()
+
+			if ok {
+				log.Printf("📤 Published kind %d to %s (%s)", ev.Kind, mr.url, latency.Round(time.Millisecond))
+			} else {
+				log.Printf("Failed to publish to %s: %v", mr.url, err)
+			}
+		}(mr, relay)
+	}
+	wg.Wait()
+	return int(accepted)
+}
+
+// Status lists every relay, sorted by URL
+func (m *relayManager) Status() []RelayStatus {
+	m.mu.RLock()
+	statuses := make([]RelayStatus, 0, len(m.relays))
+	for _, mr := range m.relays {
+		mr.mu.Lock()
+		statuses = append(statuses, mr.status)
+		mr.mu.Unlock()
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].URL < statuses[j].URL
+	})
+	return statuses
+}
+
+// ConnectedCount is the number of relays with a live connection
+func (m *relayManager) ConnectedCount() int {
+	count := 0
+	for _, status := range m.Status() {
+		if status.State == "connected" {
+			count++
+		}
+	}
+	return count
+}
+
+const (
+	// relayMaxEvents caps the events held by the embedded relay
+	relayMaxEvents = 10000
+	// relayDefaultLimit bounds the stored events sent for a filter without
+	// a limit
+	relayDefaultLimit = 500
+	relayMaxSubs      = 32
+	relayMaxMessage   = 512 * 1024
+	// relayClientQueue is how many messages may wait for a client's writer;
+	// a subscriber that falls further behind is disconnected
+	relayClientQueue = 256
+	relayWriteWait   = 10 * time.Second
+	// ephemeralTTL is how long the embedded relay keeps ephemeral events
+	// (kinds 20000-29999, which covers offers and answers). NIP-01 relays do
+	// not store them at all; holding them briefly lets a reader that
+	// subscribes just after an offer was published still receive it
+	ephemeralTTL = 10 * time.Minute
+)
+
+func isEphemeralKind(kind int) bool {
+	return kind >= 20000 && kind < 30000
+}
+
+// embeddedRelay is an in-memory NIP-01 relay so signaling can run without
+// any public relay
+type embeddedRelay struct {
+	upgrader websocket.Upgrader
+	mu       sync.RWMutex
+	events   []storedEvent // oldest first
+	ids      map[string]bool
+	clients  map[*relayClient]bool
+}
+
+type storedEvent struct {
+	event   *nostr.Event
+	expires time.Time // zero for regular events
+}
+
+// relayClient is one websocket connection. Everything it is sent goes
+// through out and is written by its own writer goroutine, so a slow client
+// never holds up the publisher
+type relayClient struct {
+	conn      *websocket.Conn
+	out       chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+	subs      map[string]nostr.Filters
+}
+
+func newRelayClient(conn *websocket.Conn) *relayClient {
+	c := &relayClient{
+		conn: conn,
+		out:  make(chan []byte, relayClientQueue),
+		done: make(chan struct{}),
+		subs: make(map[string]nostr.Filters),
+	}
+	go c.writeLoop()
+	return c
+}
+
+func newEmbeddedRelay() *embeddedRelay {
+	return &embeddedRelay{
+		upgrader: websocket.Upgrader{
+			// Relays are open to any client by design
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		ids:     make(map[string]bool),
+		clients: make(map[*relayClient]bool),
+	}
+}
+
+// startEmbeddedRelay listens on addr and returns the ws:// URL the service
+// itself should use
+func (s *TrustDiaryService) startEmbeddedRelay(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for embedded relay: %w", err)
+	}
+
+	s.localRelay = newEmbeddedRelay()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	s.localRelayURL = "ws://" + net.JoinHostPort(host, port)
+
+	go func() {
+		if err := http.Serve(listener, s.localRelay); err != nil {
+			log.Printf("Embedded relay stopped: %v", err)
+		}
+	}()
+
+	log.Printf("🛰️ Embedded Nostr relay on %s", listener.Addr())
+	return nil
+}
+
+// ServeHTTP answers NIP-11 info requests and upgrades everything else
+func (r *embeddedRelay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !websocket.IsWebSocketUpgrade(req) {
+		w.Header().Set("Content-Type", "application/nostr+json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":           "trust-diary",
+			"description":    "Embedded signaling relay for Trust Diary",
+			"supported_nips": []int{1, 11},
+			"software":       "trust-diary-nostr",
+		})
+		return
+	}
+
+	conn, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		log.Printf("Relay upgrade failed: %v", err)
+		return
+	}
+	conn.SetReadLimit(relayMaxMessage)
+
+	c := newRelayClient(conn)
+	r.mu.Lock()
+	r.clients[c] = true
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.clients, c)
+		r.mu.Unlock()
+		c.close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		r.handleMessage(c, data)
+	}
+}
+
+func (r *embeddedRelay) handleMessage(c *relayClient, data []byte) {
+	switch env := nostr.ParseMessage(data).(type) {
+	case *nostr.EventEnvelope:
+		ok, reason := r.publish(&env.Event)
+		c.send(nostr.OKEnvelope{EventID: env.Event.ID, OK: ok, Reason: reason})
+
+	case *nostr.ReqEnvelope:
+		c.mu.Lock()
+		if _, exists := c.subs[env.SubscriptionID]; !exists && len(c.subs) >= relayMaxSubs {
+			c.mu.Unlock()
+			c.send(nostr.NoticeEnvelope("too many subscriptions"))
+			return
+		}
+		c.subs[env.SubscriptionID] = env.Filters
+		c.mu.Unlock()
+
+		id := env.SubscriptionID
+		for _, ev := range r.query(env.Filters) {
+			c.send(nostr.EventEnvelope{SubscriptionID: &id, Event: *ev})
+		}
+		c.send(nostr.EOSEEnvelope(id))
+
+	case *nostr.CloseEnvelope:
+		c.mu.Lock()
+		delete(c.subs, string(*env))
+		c.mu.Unlock()
+
+	default:
+		c.send(nostr.NoticeEnvelope("could not parse message"))
+	}
+}
+
+// publish validates and stores an event, then fans it out to matching
+// subscriptions
+func (r *embeddedRelay) publish(ev *nostr.Event) (bool, string) {
+	if ev.GetID() != ev.ID {
+		return false, "invalid: event id does not match"
+	}
+	if ok, err := ev.CheckSignature(); !ok || err != nil {
+		return false, "invalid: bad signature"
+	}
+
+	now := time.Now()
+
+	r.mu.Lock()
+	if r.ids[ev.ID] {
+		r.mu.Unlock()
+		return true, "duplicate: already have this event"
+	}
+	r.pruneLocked(now)
+	stored := storedEvent{event: ev}
+	if isEphemeralKind(ev.Kind) {
+		stored.expires = now.Add(ephemeralTTL)
+	}
+	r.events = append(r.events, stored)
+	r.ids[ev.ID] = true
+
+	clients := make([]*relayClient, 0, len(r.clients))
+	for c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.mu.Unlock()
+
+	for _, c := range clients {
+		c.mu.Lock()
+		var matched []string
+		for id, filters := range c.subs {
+			if filters.Match(ev) {
+				matched = append(matched, id)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, id := range matched {
+			id := id
+			c.trySend(nostr.EventEnvelope{SubscriptionID: &id, Event: *ev})
+		}
+	}
+	return true, ""
+}
+
+// pruneLocked drops expired ephemeral events and the oldest events beyond
+// relayMaxEvents; the caller holds r.mu
+func (r *embeddedRelay) pruneLocked(now time.Time) {
+	kept := r.events[:0]
+	for _, stored := range r.events {
+		if !stored.expires.IsZero() && now.After(stored.expires) {
+			delete(r.ids, stored.event.ID)
+			continue
+		}
+		kept = append(kept, stored)
+	}
+	for len(kept) >= relayMaxEvents {
+		delete(r.ids, kept[0].event.ID)
+		kept = kept[1:]
+	}
+	r.events = kept
+}
+
+// query returns stored events matching any filter, newest first, honouring
+// each filter's limit
+func (r *embeddedRelay) query(filters nostr.Filters) []*nostr.Event {
+	now := time.Now()
+	seen := make(map[string]bool)
+	var result []*nostr.Event
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, filter := range filters {
+		limit := filter.Limit
+		if limit <= 0 || limit > relayDefaultLimit {
+			limit = relayDefaultLimit
+		}
+		count := 0
+		for i := len(r.events) - 1; i >= 0 && count < limit; i-- {
+			stored := r.events[i]
+			if !stored.expires.IsZero() && now.After(stored.expires) {
+				continue
+			}
+			if !filter.Matches(stored.event) {
+				continue
+			}
+			count++
+			if !seen[stored.event.ID] {
+				seen[stored.event.ID] = true
+				result = append(result, stored.event)
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt > result[j].CreatedAt
+	})
+	return result
+}
+
+// send queues a reply, waiting for room; it is only called from the
+// client's own read loop, so waiting slows down nobody else
+func (c *relayClient) send(env json.Marshaler) {
+	data, err := env.MarshalJSON()
+	if err != nil {
+		return
+	}
+	select {
+	case c.out <- data:
+	case <-c.done:
+	}
+}
+
+// trySend queues an event for a subscriber without waiting; a client whose
+// queue is full is disconnected rather than left behind silently
+func (c *relayClient) trySend(env json.Marshaler) {
+	data, err := env.MarshalJSON()
+	if err != nil {
+		return
+	}
+	select {
+	case c.out <- data:
+	case <-c.done:
+	default:
+		log.Printf("Relay client %s too slow, disconnecting", c.conn.RemoteAddr())
+		c.close()
+	}
+}
+
+func (c *relayClient) writeLoop() {
+	for {
+		select {
+		case data := <-c.out:
+			c.conn.SetWriteDeadline(time.Now().Add(relayWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close stops the writer and closes the connection, which also ends the
+// read loop in ServeHTTP
+func (c *relayClient) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// ICEConfig controls ICE servers and candidate filtering. It is read from
+// the JSON file named by ICE_CONFIG, then overridden by ICE_* and TURN_*
+// environment variables
+type ICEConfig struct {
+	Servers         []ICEServerConfig `json:"servers"`
+	TransportPolicy string            `json:"transportPolicy,omitempty"` // all or relay
+	CandidateTypes  []string          `json:"candidateTypes,omitempty"`  // host, srflx, prflx, relay
+	NetworkTypes    []string          `json:"networkTypes,omitempty"`    // udp4, udp6, tcp4, tcp6
+	AllowCIDRs      []string          `json:"allowCidrs,omitempty"`
+	DenyCIDRs       []string          `json:"denyCidrs,omitempty"`
+	TURN            *TURNServerConfig `json:"turn,omitempty"`
+}
+
+type ICEServerConfig struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// TURNServerConfig configures the embedded TURN relay; its credentials are
+// only used by the service and never published in offers. Unlike go-service
+// there is no way to hand readers credentials: offers are public Nostr
+// events, and readers only authenticate once the DataChannel is open
+type TURNServerConfig struct {
+	Listen       string            `json:"listen,omitempty"` // default 0.0.0.0:3478
+	PublicIP     string            `json:"publicIp"`
+	Realm        string            `json:"realm,omitempty"`
+	Users        map[string]string `json:"users,omitempty"`
+	Secret       string            `json:"secret,omitempty"` // time-windowed credentials (TURN REST scheme)
+	RelayPortMin uint16            `json:"relayPortMin,omitempty"`
+	RelayPortMax uint16            `json:"relayPortMax,omitempty"`
+	// AllowPeerCIDRs lets the relay forward to private addresses in these
+	// ranges; loopback and link-local addresses are refused regardless
+	AllowPeerCIDRs []string `json:"allowPeerCidrs,omitempty"`
+}
+
+// turnCredentialTTL is how long time-windowed TURN credentials stay valid
+const turnCredentialTTL = time.Hour
+
+func splitList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+func loadICEConfig() (ICEConfig, error) {
+	var cfg ICEConfig
+
+	if path := os.Getenv("ICE_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read ICE config: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse ICE config: %w", err)
+		}
+	}
+
+	// ICE_USERNAME and ICE_CREDENTIAL apply to the turn: URLs in ICE_SERVERS
+	if v := os.Getenv("ICE_SERVERS"); v != "" {
+		cfg.Servers = nil
+		var turnURLs []string
+		for _, url := range splitList(v) {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				turnURLs = append(turnURLs, url)
+			} else {
+				cfg.Servers = append(cfg.Servers, ICEServerConfig{URLs: []string{url}})
+			}
+		}
+		if len(turnURLs) > 0 {
+			cfg.Servers = append(cfg.Servers, ICEServerConfig{
+				URLs:       turnURLs,
+				Username:   os.Getenv("ICE_USERNAME"),
+				Credential: os.Getenv("ICE_CREDENTIAL"),
+			})
+		}
+	}
+	if v := os.Getenv("ICE_TRANSPORT_POLICY"); v != "" {
+		cfg.TransportPolicy = v
+	}
+	if v := os.Getenv("ICE_CANDIDATE_TYPES"); v != "" {
+		cfg.CandidateTypes = splitList(v)
+	}
+	if v := os.Getenv("ICE_NETWORK_TYPES"); v != "" {
+		cfg.NetworkTypes = splitList(v)
+	}
+	if v := os.Getenv("ICE_ALLOW_CIDRS"); v != "" {
+		cfg.AllowCIDRs = splitList(v)
+	}
+	if v := os.Getenv("ICE_DENY_CIDRS"); v != "" {
+		cfg.DenyCIDRs = splitList(v)
+	}
+
+	// TURN_PUBLIC_IP turns the embedded relay on
+	if v := os.Getenv("TURN_PUBLIC_IP"); v != "" {
+		if cfg.TURN == nil {
+			cfg.TURN = &TURNServerConfig{}
+		}
+		cfg.TURN.PublicIP = v
+	}
+	if cfg.TURN != nil {
+		if v := os.Getenv("TURN_LISTEN"); v != "" {
+			cfg.TURN.Listen = v
+		}
+		if v := os.Getenv("TURN_REALM"); v != "" {
+			cfg.TURN.Realm = v
+		}
+		if v := os.Getenv("TURN_SECRET"); v != "" {
+			cfg.TURN.Secret = v
+		}
+		if v := os.Getenv("TURN_ALLOW_PEER_CIDRS"); v != "" {
+			cfg.TURN.AllowPeerCIDRs = splitList(v)
+		}
+		if v := os.Getenv("TURN_USERS"); v != "" {
+			cfg.TURN.Users = make(map[string]string)
+			for _, pair := range splitList(v) {
+				user, pass, ok := strings.Cut(pair, "=")
+				if !ok {
+					return cfg, fmt.Errorf("TURN_USERS entry %q must be user=password", pair)
+				}
+				cfg.TURN.Users[user] = pass
+			}
+		}
+		if v := os.Getenv("TURN_RELAY_PORTS"); v != "" {
+			min, max, ok := strings.Cut(v, "-")
+			lo, err1 := strconv.ParseUint(min, 10, 16)
+			hi, err2 := strconv.ParseUint(max, 10, 16)
+			if !ok || err1 != nil || err2 != nil || lo > hi {
+				return cfg, fmt.Errorf("TURN_RELAY_PORTS must be min-max")
+			}
+			cfg.TURN.RelayPortMin, cfg.TURN.RelayPortMax = uint16(lo), uint16(hi)
+		}
+	}
+
+	if len(cfg.Servers) == 0 && cfg.TURN == nil {
+		cfg.Servers = []ICEServerConfig{
+			{URLs: []string{"stun:stun.l.google.com:19302"}},
+			{URLs: []string{"stun:stun1.l.google.com:19302"}},
+		}
+	}
+
+	switch cfg.TransportPolicy {
+	case "", "all", "relay":
+	default:
+		return cfg, fmt.Errorf("unknown ICE transport policy %q", cfg.TransportPolicy)
+	}
+	for _, t := range cfg.CandidateTypes {
+		if _, err := webrtc.NewICECandidateType(t); err != nil {
+			return cfg, fmt.Errorf("unknown candidate type %q", t)
+		}
+	}
+	for _, t := range cfg.NetworkTypes {
+		if _, err := webrtc.NewNetworkType(t); err != nil {
+			return cfg, fmt.Errorf("unknown network type %q", t)
+		}
+	}
+	for _, cidr := range append(append([]string(nil), cfg.AllowCIDRs...), cfg.DenyCIDRs...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return cfg, fmt.Errorf("invalid CIDR %q", cidr)
+		}
+	}
+	if cfg.TURN != nil {
+		if net.ParseIP(cfg.TURN.PublicIP) == nil {
+			return cfg, fmt.Errorf("embedded TURN needs a public IP, got %q", cfg.TURN.PublicIP)
+		}
+		if len(cfg.TURN.Users) == 0 && cfg.TURN.Secret == "" {
+			return cfg, fmt.Errorf("embedded TURN needs TURN_USERS or TURN_SECRET")
+		}
+		for _, cidr := range cfg.TURN.AllowPeerCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return cfg, fmt.Errorf("invalid TURN peer CIDR %q", cidr)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// setupICE builds the WebRTC API with the configured filters and starts the
+// embedded TURN relay
+func (s *TrustDiaryService) setupICE() error {
+	var se webrtc.SettingEngine
+
+	if len(s.ice.NetworkTypes) > 0 {
+		types := make([]webrtc.NetworkType, 0, len(s.ice.NetworkTypes))
+		for _, t := range s.ice.NetworkTypes {
+			nt, _ := webrtc.NewNetworkType(t)
+			types = append(types, nt)
+		}
+		se.SetNetworkTypes(types)
+	}
+
+	if len(s.ice.AllowCIDRs) > 0 || len(s.ice.DenyCIDRs) > 0 {
+		allow, deny := parseCIDRs(s.ice.AllowCIDRs), parseCIDRs(s.ice.DenyCIDRs)
+		se.SetIPFilter(func(ip net.IP) bool {
+			if containsIP(deny, ip) {
+				return false
+			}
+			return len(allow) == 0 || containsIP(allow, ip)
+		})
+	}
+
+	s.webrtcAPI = webrtc.NewAPI(webrtc.WithSettingEngine(se))
+
+	if s.ice.TURN != nil {
+		server, err := startTURNServer(s.ice.TURN)
+		if err != nil {
+			return err
+		}
+		s.turnServer = server
+	}
+	return nil
+}
+
+func (t *TURNServerConfig) listenAddr() string {
+	if t.Listen == "" {
+		return "0.0.0.0:3478"
+	}
+	return t.Listen
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// relayPeerAllowed reports whether the embedded relay may forward to ip;
+// loopback, link-local and other non-routable addresses are always refused,
+// private addresses unless they fall in one of the allowed ranges
+func relayPeerAllowed(ip net.IP, allowPrivate []*net.IPNet) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
 	}
+	return !ip.IsPrivate() || containsIP(allowPrivate, ip)
+}
 
-	data, err := json.MarshalIndent(stored, "", "  ")
+func startTURNServer(t *TURNServerConfig) (*turn.Server, error) {
+	conn, err := net.ListenPacket("udp4", t.listenAddr())
 	if err != nil {
-		return fmt.Errorf("failed to marshal identity: %w", err)
+		return nil, fmt.Errorf("failed to listen for TURN: %w", err)
 	}
 
-	if err := os.WriteFile(identityPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to save identity: %w", err)
+	realm := t.Realm
+	if realm == "" {
+		realm = "trust-diary"
 	}
+	keys := make(map[string][]byte, len(t.Users))
+	for user, pass := range t.Users {
+		keys[user] = turn.GenerateAuthKey(user, realm, pass)
+	}
+	var timeWindowed turn.AuthHandler
+	if t.Secret != "" {
+		timeWindowed = turn.NewLongTermAuthHandler(t.Secret, nil)
+	}
+	allowPeers := parseCIDRs(t.AllowPeerCIDRs)
 
-	log.Println("🔐 Generated new identity")
-	return nil
-}
-
-func (s *TrustDiaryService) generateNostrKeys() {
-	// Generate Nostr keys from our Ed25519 identity
-	// Nostr uses secp256k1, but we'll derive it from our Ed25519 seed
-	hash := sha256.Sum256(s.identity.PrivateKey.Seed())
-	s.nostrPrivKey = hex.EncodeToString(hash[:])
+	var relay turn.RelayAddressGenerator = &turn.RelayAddressGeneratorStatic{
+		RelayAddress: net.ParseIP(t.PublicIP),
+		Address:      "0.0.0.0",
+	}
+	if t.RelayPortMin > 0 {
+		relay = &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: net.ParseIP(t.PublicIP),
+			Address:      "0.0.0.0",
+			MinPort:      t.RelayPortMin,
+			MaxPort:      t.RelayPortMax,
+		}
+	}
 
-	// Get public key from private key
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			if key, ok := keys[username]; ok {
+				return key, true
+			}
+			if timeWindowed != nil {
+				return timeWindowed(username, realm, srcAddr)
+			}
+			return nil, false
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            conn,
+			RelayAddressGenerator: relay,
+			PermissionHandler: func(clientAddr net.Addr, peerIP net.IP) bool {
+				if !relayPeerAllowed(peerIP, allowPeers) {
+					log.Printf("⛔ TURN permission for %s refused (requested by %s)", peerIP, clientAddr)
+					return false
+				}
+				return true
+			},
+		}},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start TURN server: %w", err)
+	}
 
-	pk, _ := nostr.GetPublicKey(s.nostrPrivKey)
-	s.nostrPubKey = pk
+	log.Printf("🔁 Embedded TURN relay on %s (public %s)", t.listenAddr(), t.PublicIP)
+	return server, nil
 }
 
-func (s *TrustDiaryService) connectToNostrRelays() error {
-	for _, url := range defaultRelays {
-		relay, err := nostr.RelayConnect(context.Background(), url)
+// turnICEServer describes the embedded relay with time-windowed credentials
+// when a secret is set, otherwise the first static user
+func (s *TrustDiaryService) turnICEServer() (webrtc.ICEServer, bool) {
+	t := s.ice.TURN
+	if t == nil {
+		return webrtc.ICEServer{}, false
+	}
+
+	_, port, _ := net.SplitHostPort(t.listenAddr())
+	server := webrtc.ICEServer{
+		URLs: []string{fmt.Sprintf("turn:%s:%s?transport=udp", t.PublicIP, port)},
+	}
+	if t.Secret != "" {
+		user, pass, err := turn.GenerateLongTermCredentials(t.Secret, turnCredentialTTL)
 		if err != nil {
-			log.Printf("Failed to connect to %s: %v", url, err)
-			continue
+			log.Printf("Failed to generate TURN credentials: %v", err)
+			return webrtc.ICEServer{}, false
+		}
+		server.Username, server.Credential = user, pass
+	} else {
+		users := make([]string, 0, len(t.Users))
+		for user := range t.Users {
+			users = append(users, user)
 		}
-		s.relays = append(s.relays, relay)
-		log.Printf("✅ Connected to Nostr relay: %s", url)
+		sort.Strings(users)
+		server.Username, server.Credential = users[0], t.Users[users[0]]
 	}
+	return server, true
+}
 
-	if len(s.relays) == 0 {
-		return fmt.Errorf("failed to connect to any Nostr relay")
+func (s *TrustDiaryService) peerConnectionConfig() webrtc.Configuration {
+	config := webrtc.Configuration{}
+	for _, srv := range s.ice.Servers {
+		config.ICEServers = append(config.ICEServers, webrtc.ICEServer{
+			URLs:       srv.URLs,
+			Username:   srv.Username,
+			Credential: srv.Credential,
+		})
 	}
 
-	// Subscribe to answers to our offers
-	s.subscribeToAnswers()
+	if relay, ok := s.turnICEServer(); ok {
+		config.ICEServers = append(config.ICEServers, relay)
+	}
 
-	return nil
+	if s.ice.TransportPolicy == "relay" {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	return config
 }
 
-func (s *TrustDiaryService) subscribeToAnswers() {
-	filters := []nostr.Filter{{
-		Authors: []string{s.nostrPubKey},
-		Kinds:   []int{21001}, // Custom kind for WebRTC answers
-		Since:   &[]nostr.Timestamp{nostr.Timestamp(time.Now().Add(-24 * time.Hour).Unix())}[0],
-	}}
+// filterCandidates drops a=candidate lines whose type is not allowed; offers
+// and answers carry all candidates in the SDP since nothing is trickled
+func (s *TrustDiaryService) filterCandidates(sdp string) string {
+	if len(s.ice.CandidateTypes) == 0 {
+		return sdp
+	}
 
-	for _, relay := range s.relays {
-		sub, err := relay.Subscribe(context.Background(), filters)
-		if err != nil {
-			log.Printf("Failed to subscribe on %s: %v", relay.URL, err)
-			continue
-		}
+	allowed := make(map[string]bool, len(s.ice.CandidateTypes))
+	for _, t := range s.ice.CandidateTypes {
+		allowed[t] = true
+	}
 
-		go func(relay *nostr.Relay) {
-			for ev := range sub.Events {
-				s.handleNostrAnswer(ev)
+	lines := strings.SplitAfter(sdp, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.HasPrefix(line, "a=candidate:") {
+			fields := strings.Fields(line)
+			typ := ""
+			for i := 0; i+1 < len(fields); i++ {
+				if fields[i] == "typ" {
+					typ = fields[i+1]
+					break
+				}
 			}
-		}(relay)
+			if !allowed[typ] {
+				continue
+			}
+		}
+		kept = append(kept, line)
 	}
+	return strings.Join(kept, "")
 }
 
-func (s *TrustDiaryService) createWebRTCOffer() error {
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{URLs: []string{"stun:stun.l.google.com:19302"}},
-			{URLs: []string{"stun:stun1.l.google.com:19302"}},
-		},
-	}
+const (
+	// defaultOfferPoolSize is how many unanswered offers are kept published
+	defaultOfferPoolSize = 3
+	// offerTTL is how long an unanswered offer is valid before it is
+	// replaced; it matches how long the embedded relay keeps offers
+	offerTTL           = ephemeralTTL
+	offerSweepInterval = time.Minute
+)
+
+var (
+	errOfferUnknown = errors.New("unknown or expired offer ID")
+	errOfferTaken   = errors.New("offer already answered")
+
+	errAnswerSeen      = errors.New("answer already received")
+	errAnswerNotForUs  = errors.New("answer is not addressed to this service")
+	errAnswerUntrusted = errors.New("answer is not signed by a trusted reader")
+	errAnswerInvalid   = errors.New("malformed answer")
+
+	errNostrKeyTaken = errors.New("Nostr key already belongs to another reader")
+)
+
+// Connection is one reader session, keyed by the ID of the offer it was
+// created for
+type Connection struct {
+	ID              string     `json:"id"`
+	State           string     `json:"state"` // offered, answered or connected
+	Offer           string     `json:"-"`
+	Reader          string     `json:"reader,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	AnsweredAt      *time.Time `json:"answeredAt,omitempty"`
+	ConnectionState string     `json:"connectionState,omitempty"`
+}
+
+// createWebRTCOffer sets up a PeerConnection for one reader and registers it
+// under a fresh offer ID
+func (s *TrustDiaryService) createWebRTCOffer() (*Connection, error) {
+	offerID := generateOfferID()
 
-	pc, err := webrtc.NewPeerConnection(config)
+	pc, err := s.webrtcAPI.NewPeerConnection(s.peerConnectionConfig())
 	if err != nil {
-		return fmt.Errorf("failed to create peer connection: %w", err)
+		return nil, fmt.Errorf("failed to create peer connection: %w", err)
 	}
 
 	// Create data channel
 	dc, err := pc.CreateDataChannel("trust-diary", nil)
 	if err != nil {
-		return fmt.Errorf("failed to create data channel: %w", err)
+		pc.Close()
+		return nil, fmt.Errorf("failed to create data channel: %w", err)
 	}
 
 	dc.OnOpen(func() {
-		log.Println("📡 Data channel opened")
-		s.sendAuthChallenge()
+		log.Printf("📡 Data channel opened for offer %s", offerID)
+		s.mu.Lock()
+		if conn := s.connections[offerID]; conn != nil {
+			conn.State = "connected"
+		}
+		s.mu.Unlock()
+		s.sendAuthChallenge(offerID)
 	})
 
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		s.handleDataChannelMessage(msg.Data)
+		s.handleDataChannelMessage(offerID, msg.Data)
+	})
+
+	dc.OnClose(func() {
+		go s.closeSession(offerID)
+	})
+
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			go s.closeSession(offerID)
+		}
 	})
 
 	// Create offer
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
-		return fmt.Errorf("failed to create offer: %w", err)
+		pc.Close()
+		return nil, fmt.Errorf("failed to create offer: %w", err)
 	}
 
 	if err := pc.SetLocalDescription(offer); err != nil {
-		return fmt.Errorf("failed to set local description: %w", err)
+		pc.Close()
+		return nil, fmt.Errorf("failed to set local description: %w", err)
 	}
 
 	// Wait for ICE gathering to complete
 	gatherComplete := webrtc.GatheringCompletePromise(pc)
 	<-gatherComplete
 
-	s.peerConnection = pc
-	s.dataChannel = dc
-	s.currentOffer = pc.LocalDescription().SDP
-	s.offerID = generateOfferID()
+	conn := &Connection{
+		ID:        offerID,
+		State:     "offered",
+		Offer:     s.filterCandidates(pc.LocalDescription().SDP),
+		CreatedAt: time.Now(),
+	}
 
-	return nil
+	s.mu.Lock()
+	s.connections[offerID] = conn
+	s.peerConns[offerID] = pc
+	s.dataChannels[offerID] = dc
+	s.mu.Unlock()
+
+	return conn, nil
 }
 
 func generateOfferID() string {
@@ -301,12 +1543,189 @@ func generateOfferID() string {
 	return hex.EncodeToString(b)
 }
 
-func (s *TrustDiaryService) publishOfferToNostr() {
+// replenishOffers retires expired unanswered offers and creates new ones
+// until offerPoolSize are waiting
+func (s *TrustDiaryService) replenishOffers() error {
+	s.replenishMu.Lock()
+	defer s.replenishMu.Unlock()
+
+	var expired []string
+	pending := 0
+	s.mu.RLock()
+	for id, conn := range s.connections {
+		if conn.State != "offered" {
+			continue
+		}
+		if time.Since(conn.CreatedAt) > offerTTL {
+			expired = append(expired, id)
+		} else {
+			pending++
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, id := range expired {
+		s.removeSession(id)
+	}
+
+	for ; pending < s.offerPoolSize; pending++ {
+		conn, err := s.createWebRTCOffer()
+		if err != nil {
+			return err
+		}
+		log.Printf("🆕 Created offer %s", conn.ID)
+		s.publishOfferToNostr(conn)
+	}
+	return nil
+}
+
+// maintainOffers periodically replaces expired offers
+func (s *TrustDiaryService) maintainOffers() {
+	ticker := time.NewTicker(offerSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.replenishOffers(); err != nil {
+			log.Printf("Failed to replenish offers: %v", err)
+		}
+	}
+}
+
+// removeSession forgets a session and closes its PeerConnection; it reports
+// whether the session was still known
+func (s *TrustDiaryService) removeSession(offerID string) bool {
+	s.mu.Lock()
+	_, known := s.connections[offerID]
+	pc := s.peerConns[offerID]
+	for eventID, id := range s.offerEvents {
+		if id == offerID {
+			delete(s.offerEvents, eventID)
+		}
+	}
+	delete(s.connections, offerID)
+	delete(s.peerConns, offerID)
+	delete(s.dataChannels, offerID)
+	s.mu.Unlock()
+
+	if pc != nil {
+		pc.Close()
+	}
+	return known
+}
+
+// closeSession ends a session and tops the offer pool back up
+func (s *TrustDiaryService) closeSession(offerID string) {
+	if !s.removeSession(offerID) {
+		return
+	}
+	log.Printf("🔌 Session %s closed", offerID)
+
+	if err := s.replenishOffers(); err != nil {
+		log.Printf("Failed to replenish offers: %v", err)
+	}
+}
+
+// acceptAnswer applies a reader's answer to the offer it names; each offer
+// can be answered once. reader names who answered, if known
+func (s *TrustDiaryService) acceptAnswer(offerID, answerSDP, reader string) error {
+	s.mu.Lock()
+	conn := s.connections[offerID]
+	if conn == nil || (conn.State == "offered" && time.Since(conn.CreatedAt) > offerTTL) {
+		s.mu.Unlock()
+		return errOfferUnknown
+	}
+	if conn.State != "offered" {
+		s.mu.Unlock()
+		return errOfferTaken
+	}
+	now := time.Now()
+	conn.State = "answered"
+	conn.AnsweredAt = &now
+	conn.Reader = reader
+	pc := s.peerConns[offerID]
+	s.mu.Unlock()
+
+	// Set remote description
+	sdp := webrtc.SessionDescription{
+		Type: webrtc.SDPTypeAnswer,
+		SDP:  s.filterCandidates(answerSDP),
+	}
+
+	if err := pc.SetRemoteDescription(sdp); err != nil {
+		s.closeSession(offerID)
+		return fmt.Errorf("failed to set remote description: %w", err)
+	}
+
+	// The answered offer has left the pool
+	go func() {
+		if err := s.replenishOffers(); err != nil {
+			log.Printf("Failed to replenish offers: %v", err)
+		}
+	}()
+	return nil
+}
+
+// pendingOffer returns the newest unanswered offer, or nil if none is ready
+func (s *TrustDiaryService) pendingOffer() *Connection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var newest *Connection
+	for _, conn := range s.connections {
+		if conn.State != "offered" || time.Since(conn.CreatedAt) > offerTTL {
+			continue
+		}
+		if newest == nil || conn.CreatedAt.After(newest.CreatedAt) {
+			newest = conn
+		}
+	}
+	if newest == nil {
+		return nil
+	}
+	offer := *newest
+	return &offer
+}
+
+// sessions lists every session with its PeerConnection state, oldest first
+func (s *TrustDiaryService) sessions() []Connection {
+	s.mu.RLock()
+	list := make([]Connection, 0, len(s.connections))
+	for id, conn := range s.connections {
+		session := *conn
+		if pc := s.peerConns[id]; pc != nil {
+			session.ConnectionState = pc.ConnectionState().String()
+		}
+		list = append(list, session)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+func (s *TrustDiaryService) publishOfferToNostr(conn *Connection) {
+	s.relays.Publish(s.offerEvent(conn))
+}
+
+// republishOffer sends the pending offers to a relay that just
+// (re)connected, since offers are ephemeral and a relay that was down never
+// saw them
+func (s *TrustDiaryService) republishOffer(url string) {
+	for _, session := range s.sessions() {
+		if session.State == "offered" {
+			s.relays.PublishTo(url, s.offerEvent(&session))
+		}
+	}
+}
+
+func (s *TrustDiaryService) offerEvent(conn *Connection) nostr.Event {
 	// Create offer event
 	offerData := map[string]string{
 		"type":         "offer",
-		"sdp":          s.currentOffer,
-		"offerId":      s.offerID,
+		"sdp":          conn.Offer,
+		"offerId":      conn.ID,
 		"serviceName":  "Trust Diary",
 		"publicKey":    base64.StdEncoding.EncodeToString(s.identity.PublicKey),
 		"boxPublicKey": base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
@@ -320,7 +1739,7 @@ func (s *TrustDiaryService) publishOfferToNostr() {
 		Kind:      21000, // Custom kind for WebRTC offers
 		Tags: nostr.Tags{
 			{"service", "trust-diary"},
-			{"offer-id", s.offerID},
+			{"offer-id", conn.ID},
 		},
 		Content: string(content),
 	}
@@ -328,18 +1747,54 @@ func (s *TrustDiaryService) publishOfferToNostr() {
 	// Sign the event
 	ev.Sign(s.nostrPrivKey)
 
-	// Publish to all connected relays
-	for _, relay := range s.relays {
-		_, err := relay.Publish(context.Background(), ev)
-		if err != nil {
-			log.Printf("Failed to publish to %s: %v", relay.URL, err)
-		} else {
-			log.Printf("📤 Published offer to %s", relay.URL)
-		}
-	}
+	// Remember the event ID so answers can reference the offer with an e tag
+	s.mu.Lock()
+	s.offerEvents[ev.ID] = conn.ID
+	s.mu.Unlock()
+
+	return ev
 }
 
+// handleNostrAnswer takes an answer addressed to the service. Readers
+// publish kind 21001 with a p tag holding the service's Nostr pubkey and
+// name the offer with an offer-id tag or an e tag pointing at the offer
+// event, or else with offerId in the content, which is
+// {"type":"answer","sdp":...,"offerId":...}. The signing key must
+// belong to a trusted reader. The same event arriving from several relays is
+// handled once
 func (s *TrustDiaryService) handleNostrAnswer(ev *nostr.Event) {
+	offerID, reader, err := s.takeAnswer(ev)
+	switch {
+	case errors.Is(err, errAnswerSeen), errors.Is(err, errAnswerNotForUs):
+		return
+	case errors.Is(err, errAnswerUntrusted):
+		log.Printf("⚠️ Ignoring answer from untrusted Nostr key %s", ev.PubKey)
+		return
+	case err != nil:
+		log.Printf("Ignoring answer from %s: %v", ev.PubKey, err)
+		return
+	}
+
+	log.Printf("📥 Received answer from %s for offer %s", reader.Name, offerID)
+}
+
+// takeAnswer checks a signed answer event and applies it to its offer. It
+// is the only way an answer reaches acceptAnswer, whether it came from a
+// relay or over HTTP
+func (s *TrustDiaryService) takeAnswer(ev *nostr.Event) (string, *TrustedUser, error) {
+	if !s.firstSeenAnswer(ev.ID) {
+		return "", nil, errAnswerSeen
+	}
+
+	if ev.Kind != 21001 || !ev.Tags.ContainsAny("p", []string{s.nostrPubKey}) {
+		return "", nil, errAnswerNotForUs
+	}
+
+	reader := s.readerByNostrKey(ev.PubKey)
+	if reader == nil {
+		return "", nil, errAnswerUntrusted
+	}
+
 	// Parse answer from event
 	var answer struct {
 		Type    string `json:"type"`
@@ -348,28 +1803,66 @@ func (s *TrustDiaryService) handleNostrAnswer(ev *nostr.Event) {
 	}
 
 	if err := json.Unmarshal([]byte(ev.Content), &answer); err != nil {
-		log.Printf("Failed to parse answer: %v", err)
-		return
+		return "", reader, fmt.Errorf("%w: %v", errAnswerInvalid, err)
 	}
 
-	if answer.Type != "answer" || answer.OfferID != s.offerID {
-		return
+	if answer.Type != "answer" {
+		return "", reader, fmt.Errorf("%w: content type is %q", errAnswerInvalid, answer.Type)
 	}
 
-	log.Println("📥 Received answer from Nostr")
+	// Tags take precedence; the content offerId covers clients that send none
+	offerID := s.answeredOfferID(ev)
+	if offerID == "" {
+		offerID = answer.OfferID
+	}
+	if offerID == "" || (answer.OfferID != "" && answer.OfferID != offerID) {
+		return "", reader, fmt.Errorf("%w: offer reference missing or inconsistent", errAnswerInvalid)
+	}
 
-	// Set remote description
-	sdp := webrtc.SessionDescription{
-		Type: webrtc.SDPTypeAnswer,
-		SDP:  answer.SDP,
+	if err := s.acceptAnswer(offerID, answer.SDP, reader.Name); err != nil {
+		return offerID, reader, err
+	}
+	return offerID, reader, nil
+}
+
+// answeredOfferID resolves the offer an answer refers to, from its offer-id
+// tag or from an e tag naming one of our offer events
+func (s *TrustDiaryService) answeredOfferID(ev *nostr.Event) string {
+	if tag := ev.Tags.GetFirst([]string{"offer-id", ""}); tag != nil {
+		return tag.Value()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, tag := range ev.Tags.GetAll([]string{"e", ""}) {
+		if offerID, ok := s.offerEvents[tag.Value()]; ok {
+			return offerID
+		}
 	}
+	return ""
+}
+
+// firstSeenAnswer records an answer event ID and reports whether it is new;
+// IDs are forgotten once no offer they could answer is still valid
+func (s *TrustDiaryService) firstSeenAnswer(eventID string) bool {
+	now := time.Now()
 
-	if err := s.peerConnection.SetRemoteDescription(sdp); err != nil {
-		log.Printf("Failed to set remote description: %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, seen := s.seenAnswers[eventID]; seen {
+		return false
+	}
+	for id, at := range s.seenAnswers {
+		if now.Sub(at) > offerTTL {
+			delete(s.seenAnswers, id)
+		}
 	}
+	s.seenAnswers[eventID] = now
+	return true
 }
 
-func (s *TrustDiaryService) sendAuthChallenge() {
+func (s *TrustDiaryService) sendAuthChallenge(offerID string) {
 	challenge := make([]byte, 32)
 	rand.Read(challenge)
 
@@ -379,11 +1872,10 @@ func (s *TrustDiaryService) sendAuthChallenge() {
 		"servicePublicKey": base64.StdEncoding.EncodeToString(s.identity.PublicKey),
 	}
 
-	data, _ := json.Marshal(msg)
-	s.dataChannel.SendText(string(data))
+	s.sendToSession(offerID, msg)
 }
 
-func (s *TrustDiaryService) handleDataChannelMessage(data []byte) {
+func (s *TrustDiaryService) handleDataChannelMessage(offerID string, data []byte) {
 	var msg map[string]interface{}
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return
@@ -394,22 +1886,33 @@ func (s *TrustDiaryService) handleDataChannelMessage(data []byte) {
 	switch msgType {
 	case "response":
 		// Handle auth response
-		log.Println("Received auth response")
+		log.Printf("Received auth response for offer %s", offerID)
 	case "request":
 		// Send entries
-		s.sendEntries()
+		s.sendEntries(offerID)
 	}
 }
 
-func (s *TrustDiaryService) sendEntries() {
+func (s *TrustDiaryService) sendEntries(offerID string) {
 	for _, entry := range s.entries {
 		msg := map[string]interface{}{
 			"type":  "entry",
 			"entry": entry,
 		}
-		data, _ := json.Marshal(msg)
-		s.dataChannel.SendText(string(data))
+		s.sendToSession(offerID, msg)
+	}
+}
+
+func (s *TrustDiaryService) sendToSession(offerID string, msg interface{}) {
+	s.mu.RLock()
+	dc := s.dataChannels[offerID]
+	s.mu.RUnlock()
+	if dc == nil {
+		return
 	}
+
+	data, _ := json.Marshal(msg)
+	dc.SendText(string(data))
 }
 
 func (s *TrustDiaryService) corsMiddleware(next http.Handler) http.Handler {
@@ -430,6 +1933,30 @@ func (s *TrustDiaryService) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// localOnly restricts a handler to requests from this machine. Browsers
+// send Origin on cross-site requests, so a page on another site cannot use
+// the operator's own browser to get past the check
+func localOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !isLoopback(r.RemoteAddr) || (origin != "" && origin != "http://"+r.Host) {
+			http.Error(w, "only available from localhost", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isLoopback reports whether a remote address is on the local machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func (s *TrustDiaryService) StartHTTPServer() error {
 	router := mux.NewRouter()
 
@@ -438,6 +1965,10 @@ func (s *TrustDiaryService) StartHTTPServer() error {
 	router.HandleFunc("/api/offer", s.handleGetOffer).Methods("GET", "OPTIONS")
 	router.HandleFunc("/api/answer", s.handleSubmitAnswer).Methods("POST", "OPTIONS")
 	router.HandleFunc("/api/qr", s.handleGetQR).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/relays", s.handleGetRelays).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/relays", localOnly(s.handleAddRelay)).Methods("POST")
+	router.HandleFunc("/api/relays", localOnly(s.handleRemoveRelay)).Methods("DELETE")
+	router.HandleFunc("/api/trusted", localOnly(s.handleAddTrusted)).Methods("POST")
 
 	// Serve static files
 	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static")))
@@ -459,13 +1990,16 @@ func (s *TrustDiaryService) handleStatus(w http.ResponseWriter, r *http.Request)
 		"boxPublicKey":    base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
 		"nostrPubKey":     s.nostrPubKey,
 		"nostrNpub":       npub,
-		"offerId":         s.offerID,
-		"relaysConnected": len(s.relays),
-		"connectionState": "waiting",
+		"offerId":         "",
+		"relaysConnected": s.relays.ConnectedCount(),
+		"relays":          s.relays.Status(),
+		"embeddedRelay":   s.localRelayURL,
+		"sessions":        s.sessions(),
+		"trustedUsers":    len(s.trustedUsers),
 	}
 
-	if s.peerConnection != nil {
-		status["connectionState"] = s.peerConnection.ConnectionState().String()
+	if offer := s.pendingOffer(); offer != nil {
+		status["offerId"] = offer.ID
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -473,20 +2007,30 @@ func (s *TrustDiaryService) handleStatus(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *TrustDiaryService) handleGetOffer(w http.ResponseWriter, r *http.Request) {
+	conn := s.pendingOffer()
+	if conn == nil {
+		http.Error(w, "No offer available, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+
 	offer := map[string]string{
 		"type":    "offer",
-		"sdp":     s.currentOffer,
-		"offerId": s.offerID,
+		"sdp":     conn.Offer,
+		"offerId": conn.ID,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(offer)
 }
 
+// handleSubmitAnswer takes {"event": <signed kind 21001 answer>}, which is
+// checked exactly like an answer received from a relay. Bare
+// {"sdp","offerId"} answers are only taken when UNSIGNED_ANSWERS is set
 func (s *TrustDiaryService) handleSubmitAnswer(w http.ResponseWriter, r *http.Request) {
 	var answer struct {
-		SDP     string `json:"sdp"`
-		OfferID string `json:"offerId"`
+		Event   *nostr.Event `json:"event"`
+		SDP     string       `json:"sdp"`
+		OfferID string       `json:"offerId"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
@@ -494,33 +2038,127 @@ func (s *TrustDiaryService) handleSubmitAnswer(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	if answer.OfferID != s.offerID {
-		http.Error(w, "Invalid offer ID", http.StatusBadRequest)
+	var err error
+	switch {
+	case answer.Event != nil:
+		ev := answer.Event
+		if ok, sigErr := ev.CheckSignature(); ev.GetID() != ev.ID || !ok || sigErr != nil {
+			http.Error(w, "answer event has a bad id or signature", http.StatusBadRequest)
+			return
+		}
+		var offerID string
+		var reader *TrustedUser
+		if offerID, reader, err = s.takeAnswer(ev); err == nil {
+			log.Printf("📥 Received answer from %s for offer %s over HTTP", reader.Name, offerID)
+		}
+	case s.plainAnswers:
+		log.Printf("⚠️ Accepting unsigned answer for offer %s", answer.OfferID)
+		err = s.acceptAnswer(answer.OfferID, answer.SDP, "")
+	default:
+		http.Error(w, "answers must be a signed Nostr event from a trusted reader", http.StatusUnauthorized)
 		return
 	}
 
-	// Set remote description
-	sdp := webrtc.SessionDescription{
-		Type: webrtc.SDPTypeAnswer,
-		SDP:  answer.SDP,
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, errOfferUnknown), errors.Is(err, errAnswerInvalid), errors.Is(err, errAnswerNotForUs):
+			status = http.StatusBadRequest
+		case errors.Is(err, errOfferTaken), errors.Is(err, errAnswerSeen):
+			status = http.StatusConflict
+		case errors.Is(err, errAnswerUntrusted):
+			status = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), status)
+		return
 	}
 
-	if err := s.peerConnection.SetRemoteDescription(sdp); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
+
+// handleAddTrusted registers the Nostr key a reader signs answers with
+func (s *TrustDiaryService) handleAddTrusted(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name         string `json:"name"`
+		PublicKey    string `json:"publicKey"`
+		BoxPublicKey string `json:"boxPublicKey"`
+		NostrPubKey  string `json:"nostrPubKey"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.registerNostrKey(req.Name, req.PublicKey, req.BoxPublicKey, req.NostrPubKey)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNostrKeyTaken) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
+	log.Printf("👤 %s may answer offers with Nostr key %s", user.Name, user.NostrPubKey)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (s *TrustDiaryService) handleGetRelays(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.relays.Status())
+}
+
+func (s *TrustDiaryService) handleAddRelay(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL string `json:"url"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.relays.Add(req.URL); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errRelayExists) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	log.Printf("➕ Added Nostr relay: %s", req.URL)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s.relays.Status())
+}
+
+// handleRemoveRelay takes the relay as ?url= since it does not fit in a path
+func (s *TrustDiaryService) handleRemoveRelay(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+	if err := s.relays.Remove(url); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("➖ Removed Nostr relay: %s", url)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.relays.Status())
 }
 
 func (s *TrustDiaryService) handleGetQR(w http.ResponseWriter, r *http.Request) {
 	// Generate QR code with connection info
 	connectionInfo := map[string]string{
 		"nostrPubKey": s.nostrPubKey,
-		"offerId":     s.offerID,
 		"url":         fmt.Sprintf("http://localhost:%d", s.port),
 	}
+	if offer := s.pendingOffer(); offer != nil {
+		connectionInfo["offerId"] = offer.ID
+	}
 
 	data, _ := json.Marshal(connectionInfo)
 	qr, err := qrcode.Encode(string(data), qrcode.Medium, 256)
@@ -546,6 +2184,32 @@ func main() {
 
 	service := NewTrustDiaryService(dataDir, port)
 
+	iceConfig, err := loadICEConfig()
+	if err != nil {
+		log.Fatalf("Invalid ICE configuration: %v", err)
+	}
+	service.ice = iceConfig
+
+	if relays := os.Getenv("NOSTR_RELAYS"); relays != "" {
+		service.relayURLs = splitList(relays)
+	}
+	service.relayListen = os.Getenv("EMBEDDED_RELAY")
+
+	// Unsigned HTTP answers skip the trusted reader check, so anyone who can
+	// reach the port can take offers from the pool
+	if v := os.Getenv("UNSIGNED_ANSWERS"); v == "1" || v == "true" {
+		service.plainAnswers = true
+		log.Println("⚠️ UNSIGNED_ANSWERS is set: /api/answer accepts answers from anyone")
+	}
+
+	if size := os.Getenv("OFFER_POOL_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			log.Fatalf("OFFER_POOL_SIZE must be a positive integer")
+		}
+		service.offerPoolSize = n
+	}
+
 	if err := service.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize service: %v", err)
 	}
@@ -559,11 +2223,20 @@ func main() {
 	fmt.Println("1️⃣  NOSTR DISCOVERY (Automatic)")
 	fmt.Printf("   Share this Nostr pubkey: %s\n", service.nostrPubKey)
 	npub, _ := nip19.EncodePublicKey(service.nostrPubKey)
-	fmt.Printf("   Or npub format: %s\n\n", npub)
+	fmt.Printf("   Or npub format: %s\n", npub)
+	if service.localRelayURL != "" {
+		fmt.Printf("   Embedded relay: %s\n", service.localRelayURL)
+	}
+	fmt.Println()
 
 	fmt.Println("2️⃣  MANUAL EXCHANGE (Zero Infrastructure)")
 	fmt.Printf("   Get offer at: http://localhost:%d/api/offer\n", port)
-	fmt.Printf("   Submit answer at: http://localhost:%d/api/answer\n\n", port)
+	fmt.Printf("   Submit answer at: http://localhost:%d/api/answer\n", port)
+	if service.plainAnswers {
+		fmt.Printf("   (unsigned answers accepted)\n\n")
+	} else {
+		fmt.Printf("   (as a signed answer event from a trusted reader)\n\n")
+	}
 
 	fmt.Println("3️⃣  QR CODE")
 	fmt.Printf("   View QR at: http://localhost:%d/api/qr\n", port)
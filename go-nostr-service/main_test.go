@@ -0,0 +1,600 @@
+package main
+
+// The other main-*.go files in this directory are separate programs, so run
+// these with: go test main.go main_test.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/pion/webrtc/v3"
+)
+
+func dialRelay(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial relay: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func writeRelay(t *testing.T, conn *websocket.Conn, env interface{ MarshalJSON() ([]byte, error) }) {
+	t.Helper()
+	data, err := env.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func readRelay(t *testing.T, conn *websocket.Conn) nostr.Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	env := nostr.ParseMessage(data)
+	if env == nil {
+		t.Fatalf("unparseable relay message %s", data)
+	}
+	return env
+}
+
+func signedEvent(t *testing.T, sk string, kind int, content string, createdAt int64) nostr.Event {
+	t.Helper()
+	ev := nostr.Event{
+		Kind:      kind,
+		Content:   content,
+		CreatedAt: nostr.Timestamp(createdAt),
+		Tags:      nostr.Tags{},
+	}
+	if err := ev.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+// publishEvent sends ev and returns the relay's OK
+func publishEvent(t *testing.T, conn *websocket.Conn, ev nostr.Event) *nostr.OKEnvelope {
+	t.Helper()
+	writeRelay(t, conn, nostr.EventEnvelope{Event: ev})
+	ok, isOK := readRelay(t, conn).(*nostr.OKEnvelope)
+	if !isOK {
+		t.Fatal("expected OK after EVENT")
+	}
+	return ok
+}
+
+// collectUntilEOSE reads events for sub until its EOSE
+func collectUntilEOSE(t *testing.T, conn *websocket.Conn, sub string) []nostr.Event {
+	t.Helper()
+	var events []nostr.Event
+	for {
+		switch env := readRelay(t, conn).(type) {
+		case *nostr.EventEnvelope:
+			if env.SubscriptionID == nil || *env.SubscriptionID != sub {
+				t.Fatalf("event for unexpected subscription %v", env.SubscriptionID)
+			}
+			events = append(events, env.Event)
+		case *nostr.EOSEEnvelope:
+			if string(*env) != sub {
+				t.Fatalf("EOSE for %q, want %q", string(*env), sub)
+			}
+			return events
+		default:
+			t.Fatalf("unexpected message %T", env)
+		}
+	}
+}
+
+func TestEmbeddedRelayReqEventClose(t *testing.T) {
+	srv := httptest.NewServer(newEmbeddedRelay())
+	defer srv.Close()
+
+	reader := dialRelay(t, srv)
+	writer := dialRelay(t, srv)
+	sk := nostr.GeneratePrivateKey()
+	now := time.Now().Unix()
+
+	stored := signedEvent(t, sk, 1, "before", now-10)
+	if ok := publishEvent(t, writer, stored); !ok.OK {
+		t.Fatalf("stored event rejected: %s", ok.Reason)
+	}
+
+	// REQ returns stored events first, then live ones
+	writeRelay(t, reader, nostr.ReqEnvelope{
+		SubscriptionID: "live",
+		Filters:        nostr.Filters{{Kinds: []int{1}}},
+	})
+	if got := collectUntilEOSE(t, reader, "live"); len(got) != 1 || got[0].ID != stored.ID {
+		t.Fatalf("stored events = %v, want %s", got, stored.ID)
+	}
+
+	live := signedEvent(t, sk, 1, "during", now)
+	if ok := publishEvent(t, writer, live); !ok.OK {
+		t.Fatalf("live event rejected: %s", ok.Reason)
+	}
+	env, isEvent := readRelay(t, reader).(*nostr.EventEnvelope)
+	if !isEvent || *env.SubscriptionID != "live" || env.Event.ID != live.ID {
+		t.Fatalf("expected live event on subscription, got %#v", env)
+	}
+
+	// Other kinds don't match the filter
+	if ok := publishEvent(t, writer, signedEvent(t, sk, 7, "+", now)); !ok.OK {
+		t.Fatalf("kind 7 rejected: %s", ok.Reason)
+	}
+
+	// After CLOSE nothing more arrives on the subscription. CLOSE has no
+	// reply, so a NOTICE for garbage shows it has been handled; anything
+	// then sent to "live" would arrive before the barrier REQ's results
+	writeRelay(t, reader, nostr.CloseEnvelope("live"))
+	if err := reader.WriteMessage(websocket.TextMessage, []byte("sync")); err != nil {
+		t.Fatal(err)
+	}
+	if _, isNotice := readRelay(t, reader).(*nostr.NoticeEnvelope); !isNotice {
+		t.Fatal("expected NOTICE")
+	}
+	after := signedEvent(t, sk, 1, "after", now+1)
+	if ok := publishEvent(t, writer, after); !ok.OK {
+		t.Fatalf("event after close rejected: %s", ok.Reason)
+	}
+	writeRelay(t, reader, nostr.ReqEnvelope{
+		SubscriptionID: "barrier",
+		Filters:        nostr.Filters{{Kinds: []int{1}, Limit: 1}},
+	})
+	got := collectUntilEOSE(t, reader, "barrier")
+	if len(got) != 1 || got[0].ID != after.ID {
+		t.Fatalf("barrier events = %v, want newest %s", got, after.ID)
+	}
+}
+
+func TestEmbeddedRelayRejectsInvalidAndDuplicateEvents(t *testing.T) {
+	srv := httptest.NewServer(newEmbeddedRelay())
+	defer srv.Close()
+
+	conn := dialRelay(t, srv)
+	sk := nostr.GeneratePrivateKey()
+
+	ev := signedEvent(t, sk, 1, "hello", time.Now().Unix())
+	if ok := publishEvent(t, conn, ev); !ok.OK {
+		t.Fatalf("valid event rejected: %s", ok.Reason)
+	}
+	if ok := publishEvent(t, conn, ev); !ok.OK || !strings.HasPrefix(ok.Reason, "duplicate:") {
+		t.Fatalf("duplicate = %v %q, want accepted as duplicate", ok.OK, ok.Reason)
+	}
+
+	tampered := ev
+	tampered.Content = "changed"
+	if ok := publishEvent(t, conn, tampered); ok.OK {
+		t.Fatal("event with mismatched id accepted")
+	}
+
+	forged := signedEvent(t, sk, 1, "forged", time.Now().Unix())
+	forged.PubKey = ev.PubKey
+	other := signedEvent(t, nostr.GeneratePrivateKey(), 1, "forged", int64(forged.CreatedAt))
+	forged.Sig = other.Sig
+	if ok := publishEvent(t, conn, forged); ok.OK {
+		t.Fatal("event with bad signature accepted")
+	}
+}
+
+func TestEmbeddedRelayQueryHonoursLimit(t *testing.T) {
+	relay := newEmbeddedRelay()
+	sk := nostr.GeneratePrivateKey()
+	now := time.Now().Unix()
+
+	for i := int64(0); i < 5; i++ {
+		ev := signedEvent(t, sk, 1, "n", now+i)
+		if ok, reason := relay.publish(&ev); !ok {
+			t.Fatalf("publish: %s", reason)
+		}
+	}
+
+	got := relay.query(nostr.Filters{{Kinds: []int{1}, Limit: 2}})
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want 2", len(got))
+	}
+	if got[0].CreatedAt != nostr.Timestamp(now+4) || got[1].CreatedAt != nostr.Timestamp(now+3) {
+		t.Fatalf("got created_at %d, %d; want newest first", got[0].CreatedAt, got[1].CreatedAt)
+	}
+}
+
+func TestEmbeddedRelayExpiresEphemeralEvents(t *testing.T) {
+	relay := newEmbeddedRelay()
+	sk := nostr.GeneratePrivateKey()
+
+	offer := signedEvent(t, sk, 21000, "offer", time.Now().Unix())
+	if ok, reason := relay.publish(&offer); !ok {
+		t.Fatalf("publish: %s", reason)
+	}
+	if got := relay.query(nostr.Filters{{Kinds: []int{21000}}}); len(got) != 1 {
+		t.Fatalf("fresh ephemeral event not returned")
+	}
+
+	relay.mu.Lock()
+	relay.pruneLocked(time.Now().Add(ephemeralTTL + time.Second))
+	relay.mu.Unlock()
+	if got := relay.query(nostr.Filters{{Kinds: []int{21000}}}); len(got) != 0 {
+		t.Fatalf("expired ephemeral event still returned")
+	}
+}
+
+func TestRelayClientDropsSlowSubscriber(t *testing.T) {
+	srv := httptest.NewServer(newEmbeddedRelay())
+	defer srv.Close()
+
+	// A client with a one-slot queue and no writer never drains
+	c := &relayClient{
+		conn: dialRelay(t, srv),
+		out:  make(chan []byte, 1),
+		done: make(chan struct{}),
+	}
+	sent := make(chan struct{})
+	go func() {
+		c.trySend(nostr.NoticeEnvelope("one"))
+		c.trySend(nostr.NoticeEnvelope("two"))
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("trySend blocked on a full queue")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("slow client was not disconnected")
+	}
+}
+
+// testService returns a service with a fresh identity and a pool of one
+// offer, gathering host candidates only
+func testService(t *testing.T) *TrustDiaryService {
+	t.Helper()
+	s := NewTrustDiaryService(t.TempDir(), 0)
+	s.offerPoolSize = 1
+	s.ice = ICEConfig{NetworkTypes: []string{"udp4"}}
+	if err := s.loadOrGenerateIdentity(); err != nil {
+		t.Fatal(err)
+	}
+	s.generateNostrKeys()
+	if err := s.setupICE(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, status := range s.relays.Status() {
+			s.relays.Remove(status.URL)
+		}
+		for _, conn := range s.sessions() {
+			s.removeSession(conn.ID)
+		}
+	})
+	return s
+}
+
+// trustReader registers a reader by Nostr key and returns its secret key
+func trustReader(t *testing.T, s *TrustDiaryService, name string) string {
+	t.Helper()
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	if _, err := s.registerNostrKey(name, "", "", pk); err != nil {
+		t.Fatal(err)
+	}
+	return sk
+}
+
+// readerAnswer answers an offer from a fresh reader PeerConnection
+func readerAnswer(t *testing.T, offerSDP string) (*webrtc.PeerConnection, string) {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offerSDP}); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(answer); err != nil {
+		t.Fatal(err)
+	}
+	<-gathered
+	return pc, pc.LocalDescription().SDP
+}
+
+// answerEvent builds a signed kind 21001 event
+func answerEvent(t *testing.T, sk string, kind int, tags nostr.Tags, content map[string]string) *nostr.Event {
+	t.Helper()
+	data, _ := json.Marshal(content)
+	ev := nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		Tags:      tags,
+		Content:   string(data),
+	}
+	if err := ev.Sign(sk); err != nil {
+		t.Fatal(err)
+	}
+	return &ev
+}
+
+// offerEventID returns the ID of the event an offer was published as
+func offerEventID(s *TrustDiaryService, offerID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for eventID, id := range s.offerEvents {
+		if id == offerID {
+			return eventID
+		}
+	}
+	return ""
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestOfferAnswerOverEmbeddedRelay runs the whole signaling flow on
+// localhost: the service publishes an offer to its embedded relay, a trusted
+// reader answers it through the relay and the DataChannel opens
+func TestOfferAnswerOverEmbeddedRelay(t *testing.T) {
+	s := testService(t)
+	sk := trustReader(t, s, "Alice")
+
+	if err := s.startEmbeddedRelay("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.connectToNostrRelays(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "relay connection", func() bool { return s.relays.ConnectedCount() == 1 })
+
+	if err := s.replenishOffers(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader finds the offer on the relay
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	relay, err := nostr.RelayConnect(ctx, s.localRelayURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	sub, err := relay.Subscribe(ctx, nostr.Filters{{Kinds: []int{21000}, Authors: []string{s.nostrPubKey}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offerEv *nostr.Event
+	select {
+	case offerEv = <-sub.Events:
+	case <-ctx.Done():
+		t.Fatal("no offer on the embedded relay")
+	}
+	var offer struct {
+		SDP     string `json:"sdp"`
+		OfferID string `json:"offerId"`
+	}
+	if err := json.Unmarshal([]byte(offerEv.Content), &offer); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, answerSDP := readerAnswer(t, offer.SDP)
+	messages := make(chan string, 4)
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		dc.OnMessage(func(msg webrtc.DataChannelMessage) { messages <- string(msg.Data) })
+	})
+
+	// Answer by e tag only, as NIP-style clients do
+	answer := answerEvent(t, sk, 21001,
+		nostr.Tags{{"p", s.nostrPubKey}, {"e", offerEv.ID}},
+		map[string]string{"type": "answer", "sdp": answerSDP})
+	if _, err := relay.Publish(ctx, *answer); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-messages:
+		var msg map[string]interface{}
+		json.Unmarshal([]byte(data), &msg)
+		if msg["type"] != "challenge" {
+			t.Fatalf("first message %s, want a challenge", data)
+		}
+	case <-ctx.Done():
+		t.Fatal("DataChannel did not open")
+	}
+
+	s.mu.RLock()
+	conn := *s.connections[offer.OfferID]
+	s.mu.RUnlock()
+	if conn.Reader != "Alice" || conn.State == "offered" {
+		t.Fatalf("session %+v, want answered by Alice", conn)
+	}
+
+	// The answered offer left the pool and was replaced
+	waitFor(t, "replacement offer", func() bool {
+		pending := s.pendingOffer()
+		return pending != nil && pending.ID != offer.OfferID
+	})
+}
+
+func TestTakeAnswer(t *testing.T) {
+	s := testService(t)
+	sk := trustReader(t, s, "Alice")
+	if err := s.replenishOffers(); err != nil {
+		t.Fatal(err)
+	}
+	offer := s.pendingOffer()
+	offerEv := offerEventID(s, offer.ID)
+	_, sdp := readerAnswer(t, offer.Offer)
+
+	p := nostr.Tag{"p", s.nostrPubKey}
+	content := map[string]string{"type": "answer", "sdp": sdp}
+	withOffer := map[string]string{"type": "answer", "sdp": sdp, "offerId": offer.ID}
+
+	tests := []struct {
+		name    string
+		sk      string
+		kind    int
+		tags    nostr.Tags
+		content map[string]string
+		want    error
+	}{
+		{"untrusted key", nostr.GeneratePrivateKey(), 21001, nostr.Tags{p, {"offer-id", offer.ID}}, content, errAnswerUntrusted},
+		{"missing p tag", sk, 21001, nostr.Tags{{"offer-id", offer.ID}}, content, errAnswerNotForUs},
+		{"p tag for someone else", sk, 21001, nostr.Tags{{"p", strings.Repeat("ab", 32)}, {"offer-id", offer.ID}}, content, errAnswerNotForUs},
+		{"wrong kind", sk, 21000, nostr.Tags{p, {"offer-id", offer.ID}}, content, errAnswerNotForUs},
+		{"not an answer", sk, 21001, nostr.Tags{p, {"offer-id", offer.ID}}, map[string]string{"type": "offer", "sdp": sdp}, errAnswerInvalid},
+		{"no offer reference", sk, 21001, nostr.Tags{p}, content, errAnswerInvalid},
+		{"tag and content disagree", sk, 21001, nostr.Tags{p, {"offer-id", offer.ID}},
+			map[string]string{"type": "answer", "sdp": sdp, "offerId": "other"}, errAnswerInvalid},
+		{"e tag and content disagree", sk, 21001, nostr.Tags{p, {"e", offerEv}},
+			map[string]string{"type": "answer", "sdp": sdp, "offerId": "other"}, errAnswerInvalid},
+		{"unknown offer", sk, 21001, nostr.Tags{p, {"offer-id", "0000000000000000"}}, content, errOfferUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := s.takeAnswer(answerEvent(t, tt.sk, tt.kind, tt.tags, tt.content))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// None of the rejected answers used up the offer. The content offerId
+	// alone is enough to name it
+	valid := answerEvent(t, sk, 21001, nostr.Tags{p}, withOffer)
+	offerID, reader, err := s.takeAnswer(valid)
+	if err != nil || offerID != offer.ID || reader.Name != "Alice" {
+		t.Fatalf("valid answer: %s %v %v", offerID, reader, err)
+	}
+
+	// The same event relayed again is ignored; a second answer is refused
+	if _, _, err := s.takeAnswer(valid); !errors.Is(err, errAnswerSeen) {
+		t.Fatalf("duplicate event: got %v, want %v", err, errAnswerSeen)
+	}
+	again := answerEvent(t, sk, 21001, nostr.Tags{p, {"offer-id", offer.ID}}, content)
+	if _, _, err := s.takeAnswer(again); !errors.Is(err, errOfferTaken) {
+		t.Fatalf("second answer: got %v, want %v", err, errOfferTaken)
+	}
+}
+
+func TestSubmitAnswerOverHTTP(t *testing.T) {
+	s := testService(t)
+	trustReader(t, s, "Alice")
+	if err := s.replenishOffers(); err != nil {
+		t.Fatal(err)
+	}
+	offer := s.pendingOffer()
+
+	untrusted := answerEvent(t, nostr.GeneratePrivateKey(), 21001,
+		nostr.Tags{{"p", s.nostrPubKey}, {"offer-id", offer.ID}},
+		map[string]string{"type": "answer", "sdp": "v=0"})
+	forged := *untrusted
+	forged.Content = "{}"
+
+	tests := []struct {
+		name  string
+		plain bool
+		body  interface{}
+		want  int
+	}{
+		{"unsigned", false, map[string]string{"sdp": "v=0", "offerId": offer.ID}, http.StatusUnauthorized},
+		{"bad signature", false, map[string]interface{}{"event": forged}, http.StatusBadRequest},
+		{"untrusted reader", false, map[string]interface{}{"event": untrusted}, http.StatusForbidden},
+		{"unsigned opted in, unknown offer", true, map[string]string{"sdp": "v=0", "offerId": "nope"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.plainAnswers = tt.plain
+			body, _ := json.Marshal(tt.body)
+			w := httptest.NewRecorder()
+			s.handleSubmitAnswer(w, httptest.NewRequest("POST", "/api/answer", bytes.NewReader(body)))
+			if w.Code != tt.want {
+				t.Fatalf("status %d (%s), want %d", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+
+	// Nothing above took the offer
+	if pending := s.pendingOffer(); pending == nil || pending.ID != offer.ID {
+		t.Fatal("rejected HTTP answers used up the offer")
+	}
+}
+
+func TestRelayPeerAllowed(t *testing.T) {
+	lan := parseCIDRs([]string{"192.168.1.0/24", "127.0.0.0/8", "169.254.0.0/16"})
+
+	tests := []struct {
+		ip    string
+		allow []*net.IPNet
+		want  bool
+	}{
+		{"203.0.113.7", nil, true},
+		{"192.168.1.20", nil, false},
+		{"192.168.1.20", lan, true},
+		{"10.0.0.1", lan, false},
+		{"127.0.0.1", lan, false},
+		{"169.254.169.254", lan, false},
+		{"::1", nil, false},
+	}
+	for _, tt := range tests {
+		if got := relayPeerAllowed(net.ParseIP(tt.ip), tt.allow); got != tt.want {
+			t.Errorf("relayPeerAllowed(%s, %d ranges) = %v, want %v", tt.ip, len(tt.allow), got, tt.want)
+		}
+	}
+}
+
+func TestLoadICEConfigTURNSecret(t *testing.T) {
+	t.Setenv("TURN_PUBLIC_IP", "203.0.113.7")
+	t.Setenv("TURN_SECRET", "s3cret")
+	t.Setenv("TURN_ALLOW_PEER_CIDRS", "192.168.1.0/24")
+
+	cfg, err := loadICEConfig()
+	if err != nil {
+		t.Fatalf("secret without static users: %v", err)
+	}
+	s := &TrustDiaryService{ice: cfg}
+	relay, ok := s.turnICEServer()
+	if !ok || relay.Username == "" || relay.Credential == "" {
+		t.Fatalf("no time-windowed credentials: %+v", relay)
+	}
+	expires, err := strconv.ParseInt(strings.SplitN(relay.Username, ":", 2)[0], 10, 64)
+	if err != nil || time.Until(time.Unix(expires, 0)) > turnCredentialTTL {
+		t.Fatalf("username %q does not carry an expiry within the TTL", relay.Username)
+	}
+
+	t.Setenv("TURN_ALLOW_PEER_CIDRS", "192.168.1.0")
+	if _, err := loadICEConfig(); err == nil {
+		t.Fatal("malformed peer CIDR accepted")
+	}
+}
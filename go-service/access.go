@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// accessSweepInterval is how often live sessions are checked against their
+// user's access window
+const accessSweepInterval = 30 * time.Second
+
+var (
+	errAccessNotYetValid = errors.New("access not yet valid")
+	errAccessExpired     = errors.New("access expired")
+	errAccessSuspended   = errors.New("access suspended")
+)
+
+// checkAccess reports why the user may not act at now, or nil if they may
+func (u *TrustedUser) checkAccess(now time.Time) error {
+	if u.NotBefore != nil && now.Before(*u.NotBefore) {
+		return fmt.Errorf("%w until %s", errAccessNotYetValid, u.NotBefore.Format(time.RFC3339))
+	}
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return fmt.Errorf("%w at %s", errAccessExpired, u.ExpiresAt.Format(time.RFC3339))
+	}
+	if u.SuspendedUntil != nil && now.Before(*u.SuspendedUntil) {
+		return fmt.Errorf("%w until %s", errAccessSuspended, u.SuspendedUntil.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// closePeer sends a final notice to the peer, then closes its DataChannel
+// and PeerConnection; the signaling loop cleans up the maps when the reader
+// hangs up
+func (s *TrustDiaryService) closePeer(peerID, state string, notice map[string]interface{}) {
+	s.sendToPeer(peerID, notice)
+
+	s.mu.Lock()
+	dc := s.dataChannels[peerID]
+	pc := s.peerConns[peerID]
+	if conn := s.connections[peerID]; conn != nil {
+		conn.Authenticated = false
+		conn.SharedKey = nil
+		conn.State = state
+	}
+	s.mu.Unlock()
+
+	if dc != nil {
+		dc.Close()
+	}
+	if pc != nil {
+		pc.Close()
+	}
+}
+
+// revokeSessions ends every live session authenticated with publicKey
+func (s *TrustDiaryService) revokeSessions(publicKey string) {
+	var peers []string
+	s.mu.RLock()
+	for peerID, conn := range s.connections {
+		if conn.Authenticated && conn.PublicKey == publicKey {
+			peers = append(peers, peerID)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, peerID := range peers {
+		log.Printf("🚫 Revoking session %s...", peerID[:8])
+		s.recordAudit(AuditRecord{
+			Action:      AuditSessionRevoked,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(publicKey),
+			Detail:      "trusted user removed",
+		})
+		s.closePeer(peerID, "revoked", map[string]interface{}{
+			"type":   "revoked",
+			"reason": "trusted user removed",
+		})
+		s.events.Publish(EventPeerRevoked, map[string]string{
+			"peer":      peerID[:8],
+			"publicKey": publicKey,
+		})
+	}
+}
+
+// sweepAccess periodically disconnects sessions whose access has lapsed
+func (s *TrustDiaryService) sweepAccess() {
+	ticker := time.NewTicker(accessSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.enforceAccess()
+	}
+}
+
+// enforceAccess disconnects every authenticated peer whose user is gone or
+// outside their access window
+func (s *TrustDiaryService) enforceAccess() {
+	now := time.Now()
+
+	type lapsed struct {
+		peerID    string
+		name      string
+		publicKey string
+		err       error
+	}
+	var ended []lapsed
+
+	s.mu.RLock()
+	for peerID, conn := range s.connections {
+		if !conn.Authenticated {
+			continue
+		}
+		user := s.trustedUsers[conn.PublicKey]
+		if user == nil {
+			ended = append(ended, lapsed{peerID, conn.Name, conn.PublicKey, errNotTrusted})
+		} else if err := user.checkAccess(now); err != nil {
+			ended = append(ended, lapsed{peerID, conn.Name, conn.PublicKey, err})
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, l := range ended {
+		log.Printf("⏱️ Ending session for %s (%s...): %v", l.name, l.peerID[:8], l.err)
+		s.recordAudit(AuditRecord{
+			Action:      AuditSessionLapsed,
+			Peer:        l.peerID,
+			Fingerprint: keyFingerprint(l.publicKey),
+			Name:        l.name,
+			Detail:      l.err.Error(),
+		})
+		s.closePeer(l.peerID, "lapsed", map[string]interface{}{
+			"type":   "access-ended",
+			"reason": l.err.Error(),
+		})
+	}
+}
+
+// handleUpdateAccess extends, suspends or resumes a trusted user's access.
+// Absolute times replace the current value; extendBy and suspendFor are in
+// seconds; clear lists fields to remove
+func (s *TrustDiaryService) handleUpdateAccess(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+
+	var req struct {
+		NotBefore      *time.Time `json:"notBefore"`
+		ExpiresAt      *time.Time `json:"expiresAt"`
+		SuspendedUntil *time.Time `json:"suspendedUntil"`
+		ExtendBy       int        `json:"extendBy"`
+		SuspendFor     int        `json:"suspendFor"`
+		Clear          []string   `json:"clear"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Reject bad input before anything changes
+	for _, field := range req.Clear {
+		switch field {
+		case "notBefore", "expiresAt", "suspendedUntil":
+		default:
+			http.Error(w, fmt.Sprintf("unknown field %q", field), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	current := s.trustedUsers[key]
+	if current == nil {
+		s.mu.Unlock()
+		http.Error(w, "trusted user not found", http.StatusNotFound)
+		return
+	}
+
+	// Readers hold on to the old pointer after releasing s.mu, so change a
+	// copy and swap it in
+	user := *current
+	for _, field := range req.Clear {
+		switch field {
+		case "notBefore":
+			user.NotBefore = nil
+		case "expiresAt":
+			user.ExpiresAt = nil
+		case "suspendedUntil":
+			user.SuspendedUntil = nil
+		}
+	}
+	if req.NotBefore != nil {
+		user.NotBefore = req.NotBefore
+	}
+	if req.ExpiresAt != nil {
+		user.ExpiresAt = req.ExpiresAt
+	}
+	if req.SuspendedUntil != nil {
+		user.SuspendedUntil = req.SuspendedUntil
+	}
+	if req.ExtendBy > 0 {
+		// Extending lapsed access counts from now, not from the old expiry
+		base := now
+		if user.ExpiresAt != nil && user.ExpiresAt.After(now) {
+			base = *user.ExpiresAt
+		}
+		expires := base.Add(time.Duration(req.ExtendBy) * time.Second)
+		user.ExpiresAt = &expires
+	}
+	if req.SuspendFor > 0 {
+		until := now.Add(time.Duration(req.SuspendFor) * time.Second)
+		user.SuspendedUntil = &until
+	}
+	s.trustedUsers[key] = &user
+	updated := user
+	err := s.saveTrustedUsersLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save trusted users: %v", err)
+	}
+
+	// A suspension or shortened expiry takes effect immediately
+	s.enforceAccess()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
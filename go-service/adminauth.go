@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin authentication modes
+const (
+	AdminAuthSigned    = "signed"
+	AdminAuthLocalhost = "localhost"
+)
+
+// Signed request headers
+const (
+	headerAdminKey       = "X-Diary-Key"
+	headerAdminTimestamp = "X-Diary-Timestamp"
+	headerAdminSignature = "X-Diary-Signature"
+)
+
+const (
+	// signatureMaxSkew bounds how old or early a signed request may be
+	signatureMaxSkew = 5 * time.Minute
+	// sessionTTL is how long an issued session token stays valid
+	sessionTTL = 15 * time.Minute
+)
+
+// SessionToken is the signed payload of an admin session token
+type SessionToken struct {
+	PublicKey string `json:"key"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// replayCache remembers signatures seen within the skew window so a captured
+// signed request cannot be sent again
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // signature -> when its timestamp leaves the window
+}
+
+// firstUse records a signature and reports whether it had not been seen
+func (c *replayCache) firstUse(signature string, expires time.Time) bool {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if until, ok := c.seen[signature]; ok && now.Before(until) {
+		return false
+	}
+	for sig, until := range c.seen {
+		if !now.Before(until) {
+			delete(c.seen, sig)
+		}
+	}
+	c.seen[signature] = expires
+	return true
+}
+
+// requestSigningPayload builds the bytes a client signs for an API request
+func requestSigningPayload(method, path, timestamp string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	return []byte(strings.Join([]string{
+		method,
+		path,
+		timestamp,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n"))
+}
+
+// adminAuthMiddleware resolves the principal for every API request
+func (s *TrustDiaryService) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := s.authenticateRequest(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="trust-diary"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, withPrincipal(r, user))
+	})
+}
+
+// authenticateRequest checks a session token, signed headers or the localhost mode
+func (s *TrustDiaryService) authenticateRequest(r *http.Request) (*TrustedUser, error) {
+	if s.adminAuthMode == AdminAuthLocalhost {
+		if !isLoopback(r.RemoteAddr) {
+			return nil, errors.New("admin API only accepts localhost requests")
+		}
+		return localAdmin, nil
+	}
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return s.verifySessionToken(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	// EventSource cannot set headers, so the event stream takes the token as a query parameter
+	if token := r.URL.Query().Get("access_token"); token != "" && r.URL.Path == "/api/events" {
+		return s.verifySessionToken(token)
+	}
+
+	if r.Header.Get(headerAdminSignature) != "" {
+		return s.verifySignedRequest(r)
+	}
+
+	return nil, errNotAuthenticated
+}
+
+// verifySignedRequest checks the signature headers against the request
+func (s *TrustDiaryService) verifySignedRequest(r *http.Request) (*TrustedUser, error) {
+	keyStr := r.Header.Get(headerAdminKey)
+	tsStr := r.Header.Get(headerAdminTimestamp)
+	sigStr := r.Header.Get(headerAdminSignature)
+
+	ts, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid timestamp")
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > signatureMaxSkew || skew < -signatureMaxSkew {
+		return nil, errors.New("request timestamp outside allowed window")
+	}
+
+	pubKey, err := base64.StdEncoding.DecodeString(keyStr)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(sigStr)
+	if err != nil {
+		return nil, errors.New("invalid signature encoding")
+	}
+
+	// Read the body for hashing and put it back for the handler
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	payload := requestSigningPayload(r.Method, r.URL.RequestURI(), tsStr, body)
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), payload, signature) {
+		return nil, errors.New("signature verification failed")
+	}
+
+	// Only checked once the signature is valid, so junk cannot fill the cache
+	if !s.signedRequests.firstUse(sigStr, time.Unix(ts, 0).Add(signatureMaxSkew)) {
+		return nil, errors.New("signed request already used")
+	}
+
+	return s.principalForKey(keyStr)
+}
+
+// principalForKey maps a verified public key to the user it acts as
+func (s *TrustDiaryService) principalForKey(keyStr string) (*TrustedUser, error) {
+	if keyStr == base64.StdEncoding.EncodeToString(s.identity.PublicKey) {
+		return localAdmin, nil
+	}
+
+	s.mu.RLock()
+	user := s.trustedUsers[keyStr]
+	s.mu.RUnlock()
+
+	if user == nil {
+		return nil, errNotTrusted
+	}
+	return user, nil
+}
+
+// issueSessionToken signs a short-lived token for the given key with the service identity
+func (s *TrustDiaryService) issueSessionToken(keyStr string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(sessionTTL)
+	payload, err := json.Marshal(SessionToken{
+		PublicKey: keyStr,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	sig := ed25519.Sign(s.identity.PrivateKey, payload)
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig)
+	return token, expiresAt, nil
+}
+
+// verifySessionToken checks a token was signed by the service and has not expired
+func (s *TrustDiaryService) verifySessionToken(token string) (*TrustedUser, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed session token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed session token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed session token")
+	}
+
+	if !ed25519.Verify(s.identity.PublicKey, payload, sig) {
+		return nil, errors.New("invalid session token")
+	}
+
+	var session SessionToken
+	if err := json.Unmarshal(payload, &session); err != nil {
+		return nil, errors.New("malformed session token")
+	}
+	if time.Now().Unix() > session.ExpiresAt {
+		return nil, errors.New("session token expired")
+	}
+
+	return s.principalForKey(session.PublicKey)
+}
+
+// handleCreateSession exchanges a signed request for a session token. A
+// session token cannot mint another, or one leaked token would never expire
+func (s *TrustDiaryService) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	if s.adminAuthMode != AdminAuthLocalhost &&
+		(strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") || r.Header.Get(headerAdminSignature) == "") {
+		http.Error(w, "session tokens are only issued for signed requests", http.StatusForbidden)
+		return
+	}
+
+	// The token is bound to whoever authenticated this request
+	keyStr := principalFromRequest(r).PublicKey
+	if keyStr == "" {
+		keyStr = base64.StdEncoding.EncodeToString(s.identity.PublicKey)
+	}
+
+	token, expiresAt, err := s.issueSessionToken(keyStr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":     token,
+		"expiresAt": expiresAt,
+	})
+}
+
+// isLoopback reports whether a remote address is on the local machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
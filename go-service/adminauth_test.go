@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest builds an API request signed by key at ts
+func signedRequest(key ed25519.PrivateKey, method, path, body string, ts time.Time) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	tsStr := strconv.FormatInt(ts.Unix(), 10)
+	sig := ed25519.Sign(key, requestSigningPayload(method, path, tsStr, []byte(body)))
+	r.Header.Set(headerAdminKey, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	r.Header.Set(headerAdminTimestamp, tsStr)
+	r.Header.Set(headerAdminSignature, base64.StdEncoding.EncodeToString(sig))
+	return r
+}
+
+// sessionToken signs an arbitrary token payload with the service identity
+func sessionToken(s *TrustDiaryService, session SessionToken) string {
+	payload, _ := json.Marshal(session)
+	sig := ed25519.Sign(s.identity.PrivateKey, payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// serveAdmin runs a request through the admin middleware; the handler
+// reports the principal's name
+func serveAdmin(s *TrustDiaryService, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.adminAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(principalFromRequest(r).Name))
+	})).ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminAuthSignedRequests(t *testing.T) {
+	s := testService(t)
+	reader, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerKey := base64.StdEncoding.EncodeToString(reader.PublicKey)
+	s.trustedUsers[readerKey] = &TrustedUser{PublicKey: readerKey, Name: "Alice", Permissions: []string{PermRead}}
+	stranger, _ := generateIdentity()
+
+	now := time.Now()
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		want    int
+		as      string
+	}{
+		{"service key", func() *http.Request {
+			return signedRequest(s.identity.PrivateKey, "GET", "/api/status", "", now)
+		}, http.StatusOK, localAdmin.Name},
+		{"trusted key", func() *http.Request {
+			return signedRequest(reader.PrivateKey, "POST", "/api/entries", `{"content":"hi"}`, now)
+		}, http.StatusOK, "Alice"},
+		{"untrusted key", func() *http.Request {
+			return signedRequest(stranger.PrivateKey, "GET", "/api/status", "", now)
+		}, http.StatusUnauthorized, ""},
+		{"no credentials", func() *http.Request {
+			return httptest.NewRequest("GET", "/api/status", nil)
+		}, http.StatusUnauthorized, ""},
+		{"body changed after signing", func() *http.Request {
+			r := signedRequest(reader.PrivateKey, "POST", "/api/entries", `{"content":"hi"}`, now)
+			r.Body = http.NoBody
+			return r
+		}, http.StatusUnauthorized, ""},
+		{"path changed after signing", func() *http.Request {
+			r := signedRequest(reader.PrivateKey, "GET", "/api/entries", "", now)
+			r.URL.Path = "/api/trusted"
+			r.RequestURI = "/api/trusted"
+			return r
+		}, http.StatusUnauthorized, ""},
+		{"within skew", func() *http.Request {
+			return signedRequest(reader.PrivateKey, "GET", "/api/entries", "", now.Add(-signatureMaxSkew+time.Minute))
+		}, http.StatusOK, "Alice"},
+		{"too old", func() *http.Request {
+			return signedRequest(reader.PrivateKey, "GET", "/api/entries", "", now.Add(-signatureMaxSkew-time.Minute))
+		}, http.StatusUnauthorized, ""},
+		{"too far ahead", func() *http.Request {
+			return signedRequest(reader.PrivateKey, "GET", "/api/entries", "", now.Add(signatureMaxSkew+time.Minute))
+		}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAdmin(s, tt.request())
+			if w.Code != tt.want {
+				t.Fatalf("status %d (%s), want %d", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+			if tt.as != "" && w.Body.String() != tt.as {
+				t.Fatalf("acted as %q, want %q", w.Body.String(), tt.as)
+			}
+		})
+	}
+}
+
+func TestAdminAuthRejectsReplay(t *testing.T) {
+	s := testService(t)
+	r := signedRequest(s.identity.PrivateKey, "DELETE", "/api/trusted/x", "", time.Now())
+	replay := r.Clone(r.Context())
+
+	if w := serveAdmin(s, r); w.Code != http.StatusOK {
+		t.Fatalf("first use: status %d", w.Code)
+	}
+	if w := serveAdmin(s, replay); w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed request: status %d, want 401", w.Code)
+	}
+}
+
+func TestReplayCacheFirstUse(t *testing.T) {
+	var c replayCache
+	live := time.Now().Add(time.Minute)
+
+	if !c.firstUse("a", live) {
+		t.Fatal("new signature reported as seen")
+	}
+	if c.firstUse("a", live) {
+		t.Fatal("repeated signature accepted")
+	}
+	if !c.firstUse("b", live) {
+		t.Fatal("other signature reported as seen")
+	}
+
+	// Once a timestamp has left the window the entry is dropped; the
+	// signature itself is then refused by the skew check
+	c.firstUse("old", time.Now().Add(-time.Second))
+	c.firstUse("c", live)
+	if _, ok := c.seen["old"]; ok {
+		t.Fatal("expired signature kept in the cache")
+	}
+	if _, ok := c.seen["a"]; !ok {
+		t.Fatal("live signature evicted")
+	}
+}
+
+func TestAdminAuthSessionTokens(t *testing.T) {
+	s := testService(t)
+	serviceKey := base64.StdEncoding.EncodeToString(s.identity.PublicKey)
+	other, _ := generateIdentity()
+
+	bearer := func(token string) *http.Request {
+		r := httptest.NewRequest("GET", "/api/status", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+
+	valid := sessionToken(s, SessionToken{PublicKey: serviceKey, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if w := serveAdmin(s, bearer(valid)); w.Code != http.StatusOK {
+		t.Fatalf("valid token: status %d", w.Code)
+	}
+
+	expired := sessionToken(s, SessionToken{PublicKey: serviceKey, ExpiresAt: time.Now().Add(-time.Second).Unix()})
+	if w := serveAdmin(s, bearer(expired)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired token: status %d", w.Code)
+	}
+
+	// Signed by another key, or with its expiry pushed back
+	payload, _ := json.Marshal(SessionToken{PublicKey: serviceKey, ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	forged := base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(ed25519.Sign(other.PrivateKey, payload))
+	if w := serveAdmin(s, bearer(forged)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("forged token: status %d", w.Code)
+	}
+	extended := strings.SplitN(expired, ".", 2)
+	extended[0] = strings.SplitN(forged, ".", 2)[0]
+	if w := serveAdmin(s, bearer(strings.Join(extended, "."))); w.Code != http.StatusUnauthorized {
+		t.Fatalf("token with altered expiry: status %d", w.Code)
+	}
+}
+
+func TestCreateSession(t *testing.T) {
+	s := testService(t)
+	createSession := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.adminAuthMiddleware(http.HandlerFunc(s.handleCreateSession)).ServeHTTP(w, r)
+		return w
+	}
+
+	// A signed request gets a token that then works on its own
+	w := createSession(signedRequest(s.identity.PrivateKey, "POST", "/api/session", "", time.Now()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("signed request: status %d (%s)", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("no token in %s", w.Body.String())
+	}
+	if until := time.Until(resp.ExpiresAt); until > sessionTTL || until < sessionTTL-time.Minute {
+		t.Fatalf("token expires in %v, want about %v", until, sessionTTL)
+	}
+
+	// The token cannot be exchanged for a fresh one
+	r := httptest.NewRequest("POST", "/api/session", nil)
+	r.Header.Set("Authorization", "Bearer "+resp.Token)
+	if w := createSession(r); w.Code != http.StatusForbidden {
+		t.Fatalf("bearer token minted a session: status %d", w.Code)
+	}
+
+	// Nor can it be smuggled alongside signature headers
+	r = signedRequest(s.identity.PrivateKey, "POST", "/api/session", "", time.Now())
+	r.Header.Set("Authorization", "Bearer "+resp.Token)
+	if w := createSession(r); w.Code != http.StatusForbidden {
+		t.Fatalf("bearer token with signature headers minted a session: status %d", w.Code)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditChallengeIssued = "challenge.issued"
+	AuditSignatureFailed = "auth.signature-failed"
+	AuditUntrustedKey    = "auth.untrusted-key"
+	AuditAccessDenied    = "auth.access-denied"
+	AuditAuthenticated   = "auth.authenticated"
+	AuditChallengeStale  = "auth.challenge-stale"
+	AuditUnboundResponse = "auth.unbound"
+	AuditAuthTimeout     = "auth.timeout"
+	AuditInviteCreated   = "invite.created"
+	AuditInviteRedeemed  = "invite.redeemed"
+	AuditTrustedAdded    = "trusted.added"
+	AuditTrustedRemoved  = "trusted.removed"
+	AuditSessionRevoked  = "session.revoked"
+	AuditSessionLapsed   = "session.lapsed"
+	AuditKeyRotated      = "key.rotated"
+)
+
+const (
+	// auditDefaultMaxBytes is the size at which audit.log is rotated
+	auditDefaultMaxBytes = 10 << 20
+	// auditDefaultRetention is how long rotated audit files are kept
+	auditDefaultRetention = 90 * 24 * time.Hour
+	// auditDefaultLimit and auditMaxLimit bound GET /api/audit pages
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+// AuditRecord is one line of the audit log
+type AuditRecord struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Peer        string    `json:"peer,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Actor       string    `json:"actor,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+}
+
+// AuditFilter selects audit records
+type AuditFilter struct {
+	Actions     map[string]bool
+	Peer        string
+	Fingerprint string
+	From        time.Time
+	To          time.Time
+	Limit       int
+}
+
+// auditLog appends sealed records, one per line, to audit.log in the data
+// dir and rotates it to audit-<time>.log once it grows past maxBytes
+type auditLog struct {
+	dir       string
+	cipher    *storageCipher
+	maxBytes  int64
+	retention time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// keyFingerprint shortens a base64 public key to the first 16 hex digits of
+// its SHA-256
+func keyFingerprint(publicKey string) string {
+	if publicKey == "" {
+		return ""
+	}
+	raw, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		raw = []byte(publicKey)
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// openAuditLog opens the current audit file for appending and prunes expired
+// rotated files
+func openAuditLog(dir string, cipher *storageCipher, maxBytes int64, retention time.Duration) (*auditLog, error) {
+	a := &auditLog{
+		dir:       dir,
+		cipher:    cipher,
+		maxBytes:  maxBytes,
+		retention: retention,
+	}
+	if err := a.openCurrent(); err != nil {
+		return nil, err
+	}
+	a.prune()
+	return a, nil
+}
+
+func (a *auditLog) currentPath() string {
+	return filepath.Join(a.dir, "audit.log")
+}
+
+func (a *auditLog) openCurrent() error {
+	f, err := os.OpenFile(a.currentPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+	a.file = f
+	a.size = info.Size()
+	return nil
+}
+
+// Append writes one record and syncs it to disk
+func (a *auditLog) Append(rec AuditRecord) error {
+	plaintext, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	sealed, err := a.cipher.seal(plaintext)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.maxBytes > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxBytes {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return a.file.Sync()
+}
+
+// rotate renames the current file aside and starts a new one; the caller
+// holds a.mu
+func (a *auditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	rotated := filepath.Join(a.dir, "audit-"+time.Now().UTC().Format("20060102T150405.000000000")+".log")
+	if err := os.Rename(a.currentPath(), rotated); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	if err := a.openCurrent(); err != nil {
+		return err
+	}
+	log.Printf("🗂️ Rotated audit log to %s", filepath.Base(rotated))
+	a.prune()
+	return nil
+}
+
+// rotatedFiles lists rotated audit files, oldest first
+func (a *auditLog) rotatedFiles() []string {
+	files, _ := filepath.Glob(filepath.Join(a.dir, "audit-*.log"))
+	sort.Strings(files)
+	return files
+}
+
+// prune deletes rotated files older than the retention period
+func (a *auditLog) prune() {
+	if a.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-a.retention)
+	for _, path := range a.rotatedFiles() {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("Failed to remove expired audit file %s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+// Query returns matching records, newest first
+func (a *auditLog) Query(filter AuditFilter) ([]AuditRecord, error) {
+	a.mu.Lock()
+	paths := append(a.rotatedFiles(), a.currentPath())
+	a.mu.Unlock()
+
+	var matched []AuditRecord
+	for _, path := range paths {
+		records, err := a.readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			if filter.matches(rec) {
+				matched = append(matched, rec)
+			}
+		}
+	}
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+	if filter.Limit > 0 && len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+func (a *auditLog) readFile(path string) ([]AuditRecord, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := a.cipher.openJSON(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filepath.Base(path), line, err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// reseal rewrites every audit file under a new cipher and continues
+// appending with it
+func (a *auditLog) reseal(c *storageCipher) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, path := range append(a.rotatedFiles(), a.currentPath()) {
+		records, err := a.readFile(path)
+		if err != nil {
+			return err
+		}
+		var buf []byte
+		for _, rec := range records {
+			plaintext, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			sealed, err := c.seal(plaintext)
+			if err != nil {
+				return err
+			}
+			line, err := json.Marshal(sealed)
+			if err != nil {
+				return err
+			}
+			buf = append(append(buf, line...), '\n')
+		}
+		if err := writeFileAtomic(path, buf, 0600); err != nil {
+			return fmt.Errorf("failed to re-seal %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	// The open handle still points at the replaced file
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.cipher = c
+	return a.openCurrent()
+}
+
+// Close closes the current audit file
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// matches reports whether a record passes the filter
+func (f AuditFilter) matches(rec AuditRecord) bool {
+	if f.Actions != nil && !f.Actions[rec.Action] {
+		return false
+	}
+	if f.Peer != "" && !strings.HasPrefix(rec.Peer, f.Peer) {
+		return false
+	}
+	if f.Fingerprint != "" && rec.Fingerprint != f.Fingerprint {
+		return false
+	}
+	if !f.From.IsZero() && rec.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && rec.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// parseAuditFilter reads action, peer, key, from, to and limit; key may be
+// a fingerprint or a full public key
+func parseAuditFilter(get func(string) string) (AuditFilter, error) {
+	filter := AuditFilter{Limit: auditDefaultLimit}
+	var err error
+
+	if actions := get("action"); actions != "" {
+		filter.Actions = make(map[string]bool)
+		for _, action := range strings.Split(actions, ",") {
+			filter.Actions[strings.TrimSpace(action)] = true
+		}
+	}
+	filter.Peer = get("peer")
+	if key := get("key"); key != "" {
+		filter.Fingerprint = key
+		if len(key) != 16 {
+			filter.Fingerprint = keyFingerprint(key)
+		}
+	}
+
+	if v := get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("from must be an RFC 3339 time")
+		}
+	}
+	if v := get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("to must be an RFC 3339 time")
+		}
+	}
+	if v := get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 1 {
+			return filter, errors.New("limit must be a positive integer")
+		}
+		if filter.Limit > auditMaxLimit {
+			filter.Limit = auditMaxLimit
+		}
+	}
+	return filter, nil
+}
+
+// recordAudit appends to the audit log; a failed write is logged but never
+// blocks the action being audited
+func (s *TrustDiaryService) recordAudit(rec AuditRecord) {
+	if s.audit == nil {
+		return
+	}
+	rec.Time = time.Now().UTC()
+	if err := s.audit.Append(rec); err != nil {
+		log.Printf("⚠️ Failed to write audit record %s: %v", rec.Action, err)
+	}
+}
+
+// auditActor names the principal behind an admin request
+func auditActor(r *http.Request) string {
+	user := principalFromRequest(r)
+	if user == nil {
+		return ""
+	}
+	if user.PublicKey == "" {
+		return user.Name
+	}
+	return user.Name + " (" + keyFingerprint(user.PublicKey) + ")"
+}
+
+// handleGetAudit serves GET /api/audit
+func (s *TrustDiaryService) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query().Get)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.audit.Query(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []AuditRecord{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
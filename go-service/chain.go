@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// What loadEntries does when the hash chain is broken
+const (
+	ChainBreakRefuse     = "refuse"
+	ChainBreakQuarantine = "quarantine"
+)
+
+// chainHeadDomain separates chain head signatures from other uses of the key
+const chainHeadDomain = "trust-diary-head-v1"
+
+// ChainHead identifies the latest entry of the log
+type ChainHead struct {
+	ID        int    `json:"id"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+// EntryHash is the hex SHA-256 of an entry's canonical bytes, which include
+// the previous entry's hash and so commit to the whole history
+func EntryHash(entry DiaryEntry) string {
+	sum := sha256.Sum256(CanonicalEntryBytes(entry))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyChain returns the index of the first entry that does not link to its
+// predecessor, or -1 if the chain is intact
+func VerifyChain(entries []DiaryEntry) int {
+	prev := ""
+	for i, entry := range entries {
+		if entry.PrevHash != prev || entry.Hash != EntryHash(entry) {
+			return i
+		}
+		prev = entry.Hash
+	}
+	return -1
+}
+
+// chainHeadBytes returns the bytes a chain head signature covers
+func chainHeadBytes(id int, hash string) []byte {
+	return []byte(fmt.Sprintf("%s\n%d\n%s", chainHeadDomain, id, hash))
+}
+
+// linkEntry appends an entry to the chain after prevHash and signs it
+func (s *TrustDiaryService) linkEntry(entry *DiaryEntry, prevHash string) {
+	entry.PrevHash = prevHash
+	s.signEntry(entry)
+	entry.Hash = EntryHash(*entry)
+}
+
+// lastHash returns the hash of the newest entry; the caller holds s.mu
+func (s *TrustDiaryService) lastHash() string {
+	if len(s.entries) == 0 {
+		return ""
+	}
+	return s.entries[len(s.entries)-1].Hash
+}
+
+// chainHead returns the signed head of the entry log
+func (s *TrustDiaryService) chainHead() ChainHead {
+	s.mu.RLock()
+	head := ChainHead{Hash: s.lastHash()}
+	if len(s.entries) > 0 {
+		head.ID = s.entries[len(s.entries)-1].ID
+	}
+	s.mu.RUnlock()
+
+	sig := ed25519.Sign(s.identity.PrivateKey, chainHeadBytes(head.ID, head.Hash))
+	head.Signature = base64.StdEncoding.EncodeToString(sig)
+	return head
+}
+
+// sendChainHead tells a peer which head it has been served so readers can
+// compare notes and detect forks
+func (s *TrustDiaryService) sendChainHead(peerID string) {
+	s.sendToPeer(peerID, map[string]interface{}{
+		"type": "chain-head",
+		"head": s.chainHead(),
+	})
+}
+
+// checkEntryChain validates loaded entries, linking legacy unchained files
+// and applying the configured policy when the chain is broken.
+//
+// An unchained log is linked automatically only when every entry carries a
+// valid signature, which proves the content predates chaining. A log with no
+// signatures at all is only linked when MIGRATE_LEGACY_ENTRIES is set, since
+// stripping the chain and signature fields would otherwise turn tampering
+// into a fresh signature. Upgrading a data directory written before entries
+// were signed therefore takes one start with MIGRATE_LEGACY_ENTRIES=1; until
+// then the service refuses to start and leaves the log untouched, whatever
+// the chain break policy. Anything else goes to the chain break policy
+func (s *TrustDiaryService) checkEntryChain(entries []DiaryEntry) ([]DiaryEntry, bool, error) {
+	if len(entries) > 0 && !anyChained(entries) {
+		signed := anySigned(entries)
+		switch {
+		case signed && s.allEntriesValid(entries), !signed && s.migrateLegacy:
+			return s.linkLegacyEntries(entries), true, nil
+		case !signed:
+			return nil, false, errLegacyEntries
+		}
+	}
+
+	broken := VerifyChain(entries)
+	if broken < 0 {
+		return entries, false, nil
+	}
+
+	if s.chainBreakPolicy != ChainBreakQuarantine {
+		return nil, false, fmt.Errorf("entry hash chain broken at entry #%d", entries[broken].ID)
+	}
+
+	// Keep the intact prefix and set the full log aside for inspection
+	quarantinePath := filepath.Join(s.dataDir, fmt.Sprintf("entries.quarantine-%d.json", time.Now().Unix()))
+	if err := s.cipher.writeFile(quarantinePath, entries); err != nil {
+		return nil, false, fmt.Errorf("failed to quarantine entries: %w", err)
+	}
+
+	log.Printf("☣️ Entry hash chain broken at entry #%d; quarantined %s and kept %d entries",
+		entries[broken].ID, quarantinePath, broken)
+	return entries[:broken], true, nil
+}
+
+// errLegacyEntries means the entry log predates signing and chaining
+var errLegacyEntries = errors.New("entry log has no signatures or hash chain; if it was written by an older version, start once with MIGRATE_LEGACY_ENTRIES=1 to sign and link it")
+
+// linkLegacyEntries signs and links an unchained log in order
+func (s *TrustDiaryService) linkLegacyEntries(entries []DiaryEntry) []DiaryEntry {
+	prev := ""
+	for i := range entries {
+		s.linkEntry(&entries[i], prev)
+		prev = entries[i].Hash
+	}
+	log.Printf("⛓️ Linked %d legacy entries into a hash chain", len(entries))
+	return entries
+}
+
+// anySigned reports whether any entry carries a signature
+func anySigned(entries []DiaryEntry) bool {
+	for _, entry := range entries {
+		if entry.Signature != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// allEntriesValid reports whether every entry is signed by the service or a
+// key it has retired
+func (s *TrustDiaryService) allEntriesValid(entries []DiaryEntry) bool {
+	for _, entry := range entries {
+		if s.verifyEntry(entry) != EntryValid {
+			return false
+		}
+	}
+	return true
+}
+
+// anyChained reports whether any entry already carries chain fields
+func anyChained(entries []DiaryEntry) bool {
+	for _, entry := range entries {
+		if entry.Hash != "" || entry.PrevHash != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testService returns a service with a fresh identity and nothing on disk
+func testService(t *testing.T) *TrustDiaryService {
+	t.Helper()
+	identity, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewTrustDiaryService(t.TempDir(), 0)
+	s.identity = identity
+	return s
+}
+
+// linkedEntries builds a signed, hash-chained log of n entries
+func linkedEntries(s *TrustDiaryService, n int) []DiaryEntry {
+	entries := make([]DiaryEntry, n)
+	prev := ""
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range entries {
+		entries[i] = DiaryEntry{
+			ID:        i + 1,
+			Content:   "entry",
+			Timestamp: start.Add(time.Duration(i) * time.Hour),
+			Author:    "owner",
+		}
+		s.linkEntry(&entries[i], prev)
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+func TestVerifyChain(t *testing.T) {
+	s := testService(t)
+
+	if got := VerifyChain(nil); got != -1 {
+		t.Fatalf("empty log: got %d, want -1", got)
+	}
+	if got := VerifyChain(linkedEntries(s, 3)); got != -1 {
+		t.Fatalf("intact log: got %d, want -1", got)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]DiaryEntry) []DiaryEntry
+		want   int
+	}{
+		{"edited content", func(e []DiaryEntry) []DiaryEntry {
+			e[1].Content = "rewritten"
+			return e
+		}, 1},
+		{"rehashed edit", func(e []DiaryEntry) []DiaryEntry {
+			e[1].Content = "rewritten"
+			e[1].Hash = EntryHash(e[1])
+			return e
+		}, 2},
+		{"removed entry", func(e []DiaryEntry) []DiaryEntry {
+			return append(e[:1], e[2:]...)
+		}, 1},
+		{"reordered", func(e []DiaryEntry) []DiaryEntry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, 1},
+		{"first entry with a predecessor", func(e []DiaryEntry) []DiaryEntry {
+			e[0].PrevHash = e[2].Hash
+			return e
+		}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyChain(tt.tamper(linkedEntries(s, 3))); got != tt.want {
+				t.Fatalf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEntriesLegacyLog(t *testing.T) {
+	s := testService(t)
+	s.cipher = testCipher(t)
+	s.store = newJSONStore(s.dataDir, s.cipher)
+
+	path := filepath.Join(s.dataDir, "entries.json")
+	legacy := []byte(`[{"id":1,"content":"hello","timestamp":"2024-01-01T00:00:00Z","author":"Service"}]`)
+	if err := os.WriteFile(path, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Refused by default, without touching the file
+	if err := s.loadEntries(); !errors.Is(err, errLegacyEntries) {
+		t.Fatalf("loadEntries: %v, want errLegacyEntries", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(legacy) {
+		t.Fatal("refused log was rewritten")
+	}
+
+	// The one-time migration signs, links and seals it
+	s.migrateLegacy = true
+	if err := s.loadEntries(); err != nil {
+		t.Fatalf("migration: %v", err)
+	}
+	stored, err := s.store.ReadEntries()
+	if err != nil {
+		t.Fatalf("log not sealed after migration: %v", err)
+	}
+	if len(stored) != 1 || VerifyChain(stored) != -1 || !VerifyEntry(stored[0]) {
+		t.Fatalf("migrated log %+v is not a signed chain", stored)
+	}
+
+	// Later starts need no flag
+	s.migrateLegacy = false
+	if err := s.loadEntries(); err != nil {
+		t.Fatalf("restart after migration: %v", err)
+	}
+}
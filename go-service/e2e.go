@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// CapabilityBox means payloads are sealed with NaCl box to the reader's box key
+const CapabilityBox = "box"
+
+// serviceCapabilities is advertised to peers in the auth challenge
+var serviceCapabilities = []string{CapabilityBox, CapabilitySync, CapabilityMutual, CapabilityBinding}
+
+// hasCapability reports whether the peer's auth response lists capability
+func hasCapability(msg map[string]interface{}, capability string) bool {
+	caps, _ := msg["capabilities"].([]interface{})
+	for _, c := range caps {
+		if name, _ := c.(string); name == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncryption sets up a shared box key when both sides support it;
+// peers that don't advertise the capability fall back to plaintext
+func (s *TrustDiaryService) negotiateEncryption(conn *Connection, trusted *TrustedUser, msg map[string]interface{}) error {
+	if !hasCapability(msg, CapabilityBox) {
+		return nil
+	}
+
+	peerBoxKey, err := base64.StdEncoding.DecodeString(trusted.BoxPublicKey)
+	if err != nil || len(peerBoxKey) != 32 {
+		return errors.New("trusted user has no valid box public key")
+	}
+
+	var peerKey [32]byte
+	copy(peerKey[:], peerBoxKey)
+
+	shared := new([32]byte)
+	box.Precompute(shared, &peerKey, &s.identity.BoxPrivateKey)
+
+	s.mu.Lock()
+	conn.SharedKey = shared
+	s.mu.Unlock()
+	return nil
+}
+
+// sealMessage wraps a message in a box sealed with the connection's shared key
+func sealMessage(sharedKey *[32]byte, msg interface{}) (map[string]interface{}, error) {
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return map[string]interface{}{
+		"type":  "sealed",
+		"nonce": base64.StdEncoding.EncodeToString(nonce[:]),
+		"box":   base64.StdEncoding.EncodeToString(box.SealAfterPrecomputation(nil, plaintext, &nonce, sharedKey)),
+	}, nil
+}
+
+// openMessage decrypts a sealed message received from the peer
+func openMessage(sharedKey *[32]byte, msg map[string]interface{}) ([]byte, error) {
+	nonceStr, _ := msg["nonce"].(string)
+	boxStr, _ := msg["box"].(string)
+
+	nonceBytes, err := base64.StdEncoding.DecodeString(nonceStr)
+	if err != nil || len(nonceBytes) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(boxStr)
+	if err != nil {
+		return nil, errors.New("invalid box encoding")
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], nonceBytes)
+	plaintext, ok := box.OpenAfterPrecomputation(nil, sealed, &nonce, sharedKey)
+	if !ok {
+		return nil, errors.New("failed to open sealed message")
+	}
+	return plaintext, nil
+}
+
+// sendToPeer sends a message, sealing it when the connection negotiated box encryption
+func (s *TrustDiaryService) sendToPeer(peerID string, msg interface{}) {
+	s.mu.RLock()
+	dc := s.dataChannels[peerID]
+	var sharedKey *[32]byte
+	if conn := s.connections[peerID]; conn != nil {
+		sharedKey = conn.SharedKey
+	}
+	s.mu.RUnlock()
+
+	if dc == nil {
+		return
+	}
+
+	if sharedKey != nil {
+		sealed, err := sealMessage(sharedKey, msg)
+		if err != nil {
+			log.Printf("Failed to seal message for %s: %v", peerID[:8], err)
+			return
+		}
+		msg = sealed
+	}
+
+	data, _ := json.Marshal(msg)
+	dc.SendText(string(data))
+}
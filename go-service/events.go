@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the bus
+const (
+	EventPeerConnected     = "peer.connected"
+	EventPeerDisconnected  = "peer.disconnected"
+	EventPeerAuthenticated = "peer.authenticated"
+	EventPeerRejected      = "peer.rejected"
+	EventPeerRevoked       = "peer.revoked"
+	EventEntryAdded        = "entry.added"
+	EventEntryUpdated      = "entry.updated"
+	EventEntryDeleted      = "entry.deleted"
+	EventTrustedAdded      = "trusted.added"
+	EventTrustedRemoved    = "trusted.removed"
+)
+
+const (
+	// eventBufferSize is how many events a slow subscriber may fall behind
+	eventBufferSize = 64
+	// sseHeartbeat keeps idle event streams open through proxies
+	sseHeartbeat = 30 * time.Second
+)
+
+// Event is a typed notification about something that happened in the service
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// eventBus fans events out to subscribers without ever blocking publishers
+type eventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[chan Event]struct{}
+}
+
+// newEventBus creates an empty bus
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events and a function that ends the subscription
+func (b *eventBus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// Publish sends an event to every subscriber; subscribers whose buffer is
+// full miss the event rather than stalling the service
+func (b *eventBus) Publish(eventType string, data interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	evt := Event{
+		ID:   b.nextID,
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+// recordEventType maps a log record to the event announcing it
+func recordEventType(record DiaryEntry) string {
+	switch record.Kind {
+	case KindEdit:
+		return EventEntryUpdated
+	case KindDelete:
+		return EventEntryDeleted
+	}
+	return EventEntryAdded
+}
+
+// handleEvents streams bus events as Server-Sent Events; ?types= limits the
+// stream to a comma-separated list of event types
+func (s *TrustDiaryService) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var wanted map[string]bool
+	if types := r.URL.Query().Get("types"); types != "" {
+		wanted = make(map[string]bool)
+		for _, t := range strings.Split(types, ",") {
+			wanted[strings.TrimSpace(t)] = true
+		}
+	}
+
+	events, cancel := s.events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case evt, ok := <-events:
+			if !ok {
+				return
+			}
+			if wanted != nil && !wanted[evt.Type] {
+				continue
+			}
+			data, _ := json.Marshal(evt)
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", evt.ID, evt.Type, data)
+			flusher.Flush()
+		}
+	}
+}
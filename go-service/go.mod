@@ -5,7 +5,9 @@ go 1.21
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.1
+	github.com/pion/turn/v2 v2.1.4
 	github.com/pion/webrtc/v3 v3.2.24
+	go.etcd.io/bbolt v1.3.8
 	golang.org/x/crypto v0.18.0
 )
 
@@ -26,7 +28,6 @@ require (
 	github.com/pion/srtp/v2 v2.0.18 // indirect
 	github.com/pion/stun v0.6.1 // indirect
 	github.com/pion/transport/v2 v2.2.4 // indirect
-	github.com/pion/turn/v2 v2.1.4 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	golang.org/x/net v0.20.0 // indirect
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// authBindingDomain separates auth responses from other signatures
+	authBindingDomain = "trust-diary-auth-v1"
+	// serviceProofDomain separates the service's handshake signatures from
+	// reader responses and entry signatures
+	serviceProofDomain = "trust-diary-service-v1"
+	// CapabilityMutual means the service answers hello nonces with a proof
+	CapabilityMutual = "mutual"
+	// CapabilityBinding means the reader signs authResponseBytes rather than
+	// the bare challenge
+	CapabilityBinding = "binding"
+	// authTimeout is how long a challenge stays valid; peers that have not
+	// authenticated by then are disconnected
+	authTimeout = 30 * time.Second
+)
+
+// ChannelBinding ties a signature to one session: the service it was meant
+// for, the peer ID the service assigned and the DTLS certificate of the
+// service's end of the PeerConnection. A reader takes the fingerprint from
+// the SDP answer it received, so a response relayed through another session
+// does not verify
+type ChannelBinding struct {
+	ServicePublicKey string `json:"servicePublicKey"`
+	PeerID           string `json:"peerId"`
+	Fingerprint      string `json:"fingerprint"`
+}
+
+// authResponseBytes is what a reader signs to answer a challenge: a JSON
+// array of the domain, the base64 challenge and the binding fields
+func authResponseBytes(challenge []byte, binding ChannelBinding) []byte {
+	data, _ := json.Marshal([]string{
+		authBindingDomain,
+		base64.StdEncoding.EncodeToString(challenge),
+		binding.ServicePublicKey,
+		binding.PeerID,
+		binding.Fingerprint,
+	})
+	return data
+}
+
+// serviceProofBytes is what the service signs to prove it holds the key in
+// the challenge: the reader's nonce bound to the same session fields
+func serviceProofBytes(nonce []byte, binding ChannelBinding) []byte {
+	data, _ := json.Marshal([]string{
+		serviceProofDomain,
+		base64.StdEncoding.EncodeToString(nonce),
+		binding.ServicePublicKey,
+		binding.PeerID,
+		binding.Fingerprint,
+	})
+	return data
+}
+
+// handleHello answers a reader's nonce with a signature by the service key.
+//
+// Readers should send hello after the challenge and before answering it,
+// verify the proof against the servicePublicKey they expect and only then
+// sign the challenge or accept entries. The expected key comes from an
+// invite (the token's svc field, itself signed by that key) or, for readers
+// enrolled by hand, is pinned on first use and must match on every later
+// connection. A different key is accepted only when the rollovers chain from
+// the pinned key to it (see VerifyRollover); otherwise the reader is
+// talking to an impostor
+func (s *TrustDiaryService) handleHello(peerID string, msg map[string]interface{}) {
+	nonceStr, _ := msg["nonce"].(string)
+	nonce, err := base64.StdEncoding.DecodeString(nonceStr)
+	if err != nil || len(nonce) < 16 || len(nonce) > 64 {
+		s.sendError(peerID, "hello", errors.New("nonce must be 16 to 64 base64 bytes"))
+		return
+	}
+
+	binding := s.channelBinding(peerID)
+	signature := ed25519.Sign(s.identity.PrivateKey, serviceProofBytes(nonce, binding))
+
+	// Sent in plaintext: the proof must be checkable before any key agreement
+	s.mu.RLock()
+	dc := s.dataChannels[peerID]
+	s.mu.RUnlock()
+	if dc == nil {
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":             "service-proof",
+		"proof":            serviceProofDomain,
+		"nonce":            nonceStr,
+		"servicePublicKey": binding.ServicePublicKey,
+		"peerId":           binding.PeerID,
+		"fingerprint":      binding.Fingerprint,
+		"signature":        base64.StdEncoding.EncodeToString(signature),
+		"rollovers":        s.keys.Rollovers,
+	})
+	dc.SendText(string(data))
+}
+
+// dtlsFingerprint returns the first a=fingerprint of the local description,
+// normalised to "<algorithm> <HEX:HEX:...>"
+func dtlsFingerprint(pc *webrtc.PeerConnection) string {
+	if pc == nil {
+		return ""
+	}
+	desc := pc.LocalDescription()
+	if desc == nil {
+		return ""
+	}
+	for _, line := range strings.Split(desc.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "a=fingerprint:") {
+			continue
+		}
+		parts := strings.Fields(strings.TrimPrefix(line, "a=fingerprint:"))
+		if len(parts) != 2 {
+			continue
+		}
+		return strings.ToLower(parts[0]) + " " + strings.ToUpper(parts[1])
+	}
+	return ""
+}
+
+// channelBinding builds the binding for a peer's current session
+func (s *TrustDiaryService) channelBinding(peerID string) ChannelBinding {
+	s.mu.RLock()
+	pc := s.peerConns[peerID]
+	s.mu.RUnlock()
+
+	return ChannelBinding{
+		ServicePublicKey: base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+		PeerID:           peerID,
+		Fingerprint:      dtlsFingerprint(pc),
+	}
+}
+
+// takeChallenge returns the peer's outstanding challenge and clears it, so
+// each challenge is answered at most once; expired challenges are discarded
+func (s *TrustDiaryService) takeChallenge(peerID string) (*Connection, []byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn := s.connections[peerID]
+	if conn == nil || conn.Challenge == nil {
+		return conn, nil, false
+	}
+	challenge := conn.Challenge
+	expired := time.Now().After(conn.ChallengeExpires)
+	conn.Challenge = nil
+	return conn, challenge, !expired
+}
+
+// setConnState records a connection's state under s.mu, which the status
+// and access handlers hold while they read it
+func (s *TrustDiaryService) setConnState(conn *Connection, state string) {
+	s.mu.Lock()
+	conn.State = state
+	s.mu.Unlock()
+}
+
+// expireUnauthenticated disconnects a peer that has not authenticated
+// within authTimeout of its challenge
+func (s *TrustDiaryService) expireUnauthenticated(peerID string) {
+	s.mu.RLock()
+	conn := s.connections[peerID]
+	pending := conn != nil && !conn.Authenticated && conn.State != "revoked" && conn.State != "lapsed"
+	s.mu.RUnlock()
+
+	if !pending {
+		return
+	}
+
+	log.Printf("⏱️ %s... did not authenticate in time", peerID[:8])
+	s.recordAudit(AuditRecord{
+		Action: AuditAuthTimeout,
+		Peer:   peerID,
+	})
+	s.closePeer(peerID, "timeout", map[string]interface{}{
+		"type":    "error",
+		"request": "response",
+		"error":   "authentication timed out",
+	})
+}
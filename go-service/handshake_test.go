@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// challengedPeer registers a connection with an outstanding challenge
+func challengedPeer(s *TrustDiaryService, peerID string) []byte {
+	challenge := make([]byte, 32)
+	rand.Read(challenge)
+	s.connections[peerID] = &Connection{
+		ID:               peerID,
+		State:            "connected",
+		Challenge:        challenge,
+		ChallengeExpires: time.Now().Add(authTimeout),
+	}
+	return challenge
+}
+
+func TestHandleAuthResponseBinding(t *testing.T) {
+	reader, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerKey := base64.StdEncoding.EncodeToString(reader.PublicKey)
+
+	tests := []struct {
+		name    string
+		unbound bool // service allows ALLOW_UNBOUND_AUTH
+		sign    func(s *TrustDiaryService, peerID string, challenge []byte) []byte
+		caps    []interface{}
+		want    bool
+	}{
+		{"bound", false, func(s *TrustDiaryService, peerID string, challenge []byte) []byte {
+			return authResponseBytes(challenge, s.channelBinding(peerID))
+		}, []interface{}{CapabilityBinding}, true},
+		{"bound to another session", false, func(s *TrustDiaryService, peerID string, challenge []byte) []byte {
+			return authResponseBytes(challenge, s.channelBinding("other-peer"))
+		}, []interface{}{CapabilityBinding}, false},
+		{"unbound", false, func(s *TrustDiaryService, peerID string, challenge []byte) []byte {
+			return challenge
+		}, nil, false},
+		{"unbound claiming binding", false, func(s *TrustDiaryService, peerID string, challenge []byte) []byte {
+			return challenge
+		}, []interface{}{CapabilityBinding}, false},
+		{"unbound when allowed", true, func(s *TrustDiaryService, peerID string, challenge []byte) []byte {
+			return challenge
+		}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			s.allowUnboundAuth = tt.unbound
+			s.trustedUsers[readerKey] = &TrustedUser{PublicKey: readerKey, Name: "Alice", Permissions: []string{PermRead}}
+
+			peerID := "peer-0123456789"
+			challenge := challengedPeer(s, peerID)
+			signature := ed25519.Sign(reader.PrivateKey, tt.sign(s, peerID, challenge))
+			s.handleAuthResponse(peerID, map[string]interface{}{
+				"type":         "response",
+				"publicKey":    readerKey,
+				"signature":    base64.StdEncoding.EncodeToString(signature),
+				"capabilities": tt.caps,
+			})
+
+			conn := s.connections[peerID]
+			if conn.Authenticated != tt.want {
+				t.Fatalf("authenticated = %v, want %v (state %q)", conn.Authenticated, tt.want, conn.State)
+			}
+			if conn.Challenge != nil {
+				t.Fatal("challenge was not consumed")
+			}
+		})
+	}
+}
+
+// TestHandleAuthResponseRejectedStates checks each refusal leaves the session
+// in the right state. Run with -race: the status handler reads the state
+// concurrently, so every write must hold s.mu
+func TestHandleAuthResponseRejectedStates(t *testing.T) {
+	reader, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerKey := base64.StdEncoding.EncodeToString(reader.PublicKey)
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		user   *TrustedUser
+		invite string
+		want   string
+	}{
+		{"untrusted", nil, "", "untrusted"},
+		{"bad invite", nil, "not-a-token", "untrusted"},
+		{"access expired", &TrustedUser{PublicKey: readerKey, Name: "Alice", ExpiresAt: &expired}, "", "lapsed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			if tt.user != nil {
+				s.trustedUsers[readerKey] = tt.user
+			}
+			peerID := "peer-0123456789"
+			challenge := challengedPeer(s, peerID)
+			signature := ed25519.Sign(reader.PrivateKey, authResponseBytes(challenge, s.channelBinding(peerID)))
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 50; i++ {
+					s.handleStatus(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/status", nil))
+				}
+			}()
+			s.handleAuthResponse(peerID, map[string]interface{}{
+				"type":         "response",
+				"publicKey":    readerKey,
+				"signature":    base64.StdEncoding.EncodeToString(signature),
+				"capabilities": []interface{}{CapabilityBinding},
+				"invite":       tt.invite,
+			})
+			<-done
+
+			s.mu.RLock()
+			state, authenticated := s.connections[peerID].State, s.connections[peerID].Authenticated
+			s.mu.RUnlock()
+			if state != tt.want || authenticated {
+				t.Fatalf("state %q authenticated=%v, want %q", state, authenticated, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// defaultSTUNServer is used when no ICE servers are configured
+	defaultSTUNServer = "stun:stun.l.google.com:19302"
+	// turnCredentialTTL is how long time-windowed TURN credentials stay valid
+	turnCredentialTTL = time.Hour
+)
+
+// ICEConfig controls how peer connections gather and accept candidates. It
+// is read from the JSON file named by ICE_CONFIG, then overridden by ICE_*
+// and TURN_* environment variables
+type ICEConfig struct {
+	Servers []ICEServerConfig `json:"servers"`
+	// TransportPolicy is "all" (default) or "relay"
+	TransportPolicy string `json:"transportPolicy,omitempty"`
+	// CandidateTypes limits local and remote candidates to host, srflx,
+	// prflx and/or relay; empty allows all
+	CandidateTypes []string `json:"candidateTypes,omitempty"`
+	// NetworkTypes limits gathering to udp4, udp6, tcp4 and/or tcp6
+	NetworkTypes []string `json:"networkTypes,omitempty"`
+	// AllowCIDRs and DenyCIDRs filter the local addresses used for candidates
+	AllowCIDRs []string `json:"allowCidrs,omitempty"`
+	DenyCIDRs  []string `json:"denyCidrs,omitempty"`
+	// TURN configures the embedded relay; nil disables it
+	TURN *TURNServerConfig `json:"turn,omitempty"`
+}
+
+// ICEServerConfig is one STUN or TURN server
+type ICEServerConfig struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// TURNServerConfig configures the embedded TURN relay
+type TURNServerConfig struct {
+	// Listen is the UDP address to serve on, default 0.0.0.0:3478
+	Listen string `json:"listen,omitempty"`
+	// PublicIP is the address relayed candidates advertise
+	PublicIP string `json:"publicIp"`
+	Realm    string `json:"realm,omitempty"`
+	// Users are static username/password pairs
+	Users map[string]string `json:"users,omitempty"`
+	// Secret enables time-windowed credentials (the TURN REST scheme)
+	Secret string `json:"secret,omitempty"`
+	// ShareWithReaders hands each authenticated reader its own time-windowed
+	// credentials for later connections; it requires Secret. Otherwise the
+	// relay only serves the service's own end of each PeerConnection
+	ShareWithReaders bool `json:"shareWithReaders,omitempty"`
+	// AllowPeerCIDRs lets the relay forward to private addresses in these
+	// ranges, for readers on the service's own network. Loopback and
+	// link-local addresses are refused regardless
+	AllowPeerCIDRs []string `json:"allowPeerCidrs,omitempty"`
+
+	RelayPortMin uint16 `json:"relayPortMin,omitempty"`
+	RelayPortMax uint16 `json:"relayPortMax,omitempty"`
+}
+
+// loadICEConfig reads ICE_CONFIG and applies environment overrides
+func loadICEConfig() (ICEConfig, error) {
+	var cfg ICEConfig
+
+	if path := os.Getenv("ICE_CONFIG"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read ICE config: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("failed to parse ICE config: %w", err)
+		}
+	}
+
+	// ICE_SERVERS replaces the server list; ICE_USERNAME and ICE_CREDENTIAL
+	// apply to its turn: and turns: URLs
+	if v := os.Getenv("ICE_SERVERS"); v != "" {
+		cfg.Servers = nil
+		var turnURLs []string
+		for _, url := range splitList(v) {
+			if strings.HasPrefix(url, "turn:") || strings.HasPrefix(url, "turns:") {
+				turnURLs = append(turnURLs, url)
+			} else {
+				cfg.Servers = append(cfg.Servers, ICEServerConfig{URLs: []string{url}})
+			}
+		}
+		if len(turnURLs) > 0 {
+			cfg.Servers = append(cfg.Servers, ICEServerConfig{
+				URLs:       turnURLs,
+				Username:   os.Getenv("ICE_USERNAME"),
+				Credential: os.Getenv("ICE_CREDENTIAL"),
+			})
+		}
+	}
+	if v := os.Getenv("ICE_TRANSPORT_POLICY"); v != "" {
+		cfg.TransportPolicy = v
+	}
+	if v := os.Getenv("ICE_CANDIDATE_TYPES"); v != "" {
+		cfg.CandidateTypes = splitList(v)
+	}
+	if v := os.Getenv("ICE_NETWORK_TYPES"); v != "" {
+		cfg.NetworkTypes = splitList(v)
+	}
+	if v := os.Getenv("ICE_ALLOW_CIDRS"); v != "" {
+		cfg.AllowCIDRs = splitList(v)
+	}
+	if v := os.Getenv("ICE_DENY_CIDRS"); v != "" {
+		cfg.DenyCIDRs = splitList(v)
+	}
+
+	// TURN_PUBLIC_IP turns the embedded relay on
+	if v := os.Getenv("TURN_PUBLIC_IP"); v != "" {
+		if cfg.TURN == nil {
+			cfg.TURN = &TURNServerConfig{}
+		}
+		cfg.TURN.PublicIP = v
+	}
+	if cfg.TURN != nil {
+		if v := os.Getenv("TURN_LISTEN"); v != "" {
+			cfg.TURN.Listen = v
+		}
+		if v := os.Getenv("TURN_REALM"); v != "" {
+			cfg.TURN.Realm = v
+		}
+		if v := os.Getenv("TURN_SECRET"); v != "" {
+			cfg.TURN.Secret = v
+		}
+		if v := os.Getenv("TURN_SHARE_WITH_READERS"); v != "" {
+			cfg.TURN.ShareWithReaders = v == "1" || v == "true"
+		}
+		if v := os.Getenv("TURN_ALLOW_PEER_CIDRS"); v != "" {
+			cfg.TURN.AllowPeerCIDRs = splitList(v)
+		}
+		if v := os.Getenv("TURN_USERS"); v != "" {
+			cfg.TURN.Users = make(map[string]string)
+			for _, pair := range splitList(v) {
+				user, pass, ok := strings.Cut(pair, "=")
+				if !ok {
+					return cfg, fmt.Errorf("TURN_USERS entry %q must be user=password", pair)
+				}
+				cfg.TURN.Users[user] = pass
+			}
+		}
+		if v := os.Getenv("TURN_RELAY_PORTS"); v != "" {
+			min, max, ok := strings.Cut(v, "-")
+			lo, err1 := strconv.ParseUint(min, 10, 16)
+			hi, err2 := strconv.ParseUint(max, 10, 16)
+			if !ok || err1 != nil || err2 != nil || lo > hi {
+				return cfg, fmt.Errorf("TURN_RELAY_PORTS must be min-max")
+			}
+			cfg.TURN.RelayPortMin, cfg.TURN.RelayPortMax = uint16(lo), uint16(hi)
+		}
+	}
+
+	if len(cfg.Servers) == 0 && cfg.TURN == nil {
+		cfg.Servers = []ICEServerConfig{{URLs: []string{defaultSTUNServer}}}
+	}
+	return cfg, cfg.validate()
+}
+
+// splitList splits a comma or whitespace separated list
+func splitList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// validate checks the names and addresses in the config
+func (c ICEConfig) validate() error {
+	switch c.TransportPolicy {
+	case "", "all", "relay":
+	default:
+		return fmt.Errorf("unknown ICE transport policy %q", c.TransportPolicy)
+	}
+	for _, t := range c.CandidateTypes {
+		if _, err := webrtc.NewICECandidateType(t); err != nil {
+			return fmt.Errorf("unknown candidate type %q", t)
+		}
+	}
+	for _, t := range c.NetworkTypes {
+		if _, err := webrtc.NewNetworkType(t); err != nil {
+			return fmt.Errorf("unknown network type %q", t)
+		}
+	}
+	for _, cidr := range append(append([]string(nil), c.AllowCIDRs...), c.DenyCIDRs...) {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR %q", cidr)
+		}
+	}
+	if c.TURN != nil {
+		if net.ParseIP(c.TURN.PublicIP) == nil {
+			return fmt.Errorf("embedded TURN needs a public IP, got %q", c.TURN.PublicIP)
+		}
+		if len(c.TURN.Users) == 0 && c.TURN.Secret == "" {
+			return fmt.Errorf("embedded TURN needs users or a secret")
+		}
+		// A static password given to one reader would be shared by all of
+		// them and could not be withdrawn
+		if c.TURN.ShareWithReaders && (c.TURN.Secret == "" || len(c.TURN.Users) > 0) {
+			return fmt.Errorf("embedded TURN can only be shared with readers using a secret and no static users")
+		}
+		for _, cidr := range c.TURN.AllowPeerCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid TURN peer CIDR %q", cidr)
+			}
+		}
+	}
+	return nil
+}
+
+// newWebRTCAPI applies network type and address filters to a WebRTC API
+func newWebRTCAPI(cfg ICEConfig) (*webrtc.API, error) {
+	var se webrtc.SettingEngine
+
+	if len(cfg.NetworkTypes) > 0 {
+		types := make([]webrtc.NetworkType, 0, len(cfg.NetworkTypes))
+		for _, t := range cfg.NetworkTypes {
+			nt, err := webrtc.NewNetworkType(t)
+			if err != nil {
+				return nil, err
+			}
+			types = append(types, nt)
+		}
+		se.SetNetworkTypes(types)
+	}
+
+	if len(cfg.AllowCIDRs) > 0 || len(cfg.DenyCIDRs) > 0 {
+		allow, deny := parseCIDRs(cfg.AllowCIDRs), parseCIDRs(cfg.DenyCIDRs)
+		se.SetIPFilter(func(ip net.IP) bool {
+			if containsIP(deny, ip) {
+				return false
+			}
+			return len(allow) == 0 || containsIP(allow, ip)
+		})
+	}
+
+	return webrtc.NewAPI(webrtc.WithSettingEngine(se)), nil
+}
+
+func parseCIDRs(cidrs []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// listenAddr returns the embedded relay's listen address
+func (t *TURNServerConfig) listenAddr() string {
+	if t.Listen == "" {
+		return "0.0.0.0:3478"
+	}
+	return t.Listen
+}
+
+// iceServers returns the configured servers, which readers may be told
+// about before they authenticate
+func (s *TrustDiaryService) iceServers() []webrtc.ICEServer {
+	servers := make([]webrtc.ICEServer, 0, len(s.ice.Servers)+1)
+	for _, srv := range s.ice.Servers {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       srv.URLs,
+			Username:   srv.Username,
+			Credential: srv.Credential,
+		})
+	}
+	return servers
+}
+
+// serviceICEServers returns the servers for the service's own end of a
+// session: the configured ones plus the embedded relay
+func (s *TrustDiaryService) serviceICEServers() []webrtc.ICEServer {
+	servers := s.iceServers()
+	if relay, ok := s.turnICEServer(); ok {
+		servers = append(servers, relay)
+	}
+	return servers
+}
+
+// readerTURNServers returns fresh embedded relay credentials for an
+// authenticated reader, or nil unless sharing is enabled
+func (s *TrustDiaryService) readerTURNServers() []webrtc.ICEServer {
+	if s.ice.TURN == nil || !s.ice.TURN.ShareWithReaders {
+		return nil
+	}
+	relay, ok := s.turnICEServer()
+	if !ok {
+		return nil
+	}
+	return []webrtc.ICEServer{relay}
+}
+
+// turnICEServer describes the embedded relay with time-windowed credentials
+// when a secret is set, otherwise the first static user
+func (s *TrustDiaryService) turnICEServer() (webrtc.ICEServer, bool) {
+	t := s.ice.TURN
+	if t == nil || s.turnServer == nil {
+		return webrtc.ICEServer{}, false
+	}
+
+	_, port, _ := net.SplitHostPort(t.listenAddr())
+	server := webrtc.ICEServer{
+		URLs: []string{fmt.Sprintf("turn:%s:%s?transport=udp", t.PublicIP, port)},
+	}
+	if t.Secret != "" {
+		user, pass, err := turn.GenerateLongTermCredentials(t.Secret, turnCredentialTTL)
+		if err != nil {
+			log.Printf("Failed to generate TURN credentials: %v", err)
+			return webrtc.ICEServer{}, false
+		}
+		server.Username, server.Credential = user, pass
+	} else {
+		users := make([]string, 0, len(t.Users))
+		for user := range t.Users {
+			users = append(users, user)
+		}
+		sort.Strings(users)
+		server.Username, server.Credential = users[0], t.Users[users[0]]
+	}
+	return server, true
+}
+
+// peerConnectionConfig builds the configuration for a new PeerConnection
+func (s *TrustDiaryService) peerConnectionConfig(servers []webrtc.ICEServer) webrtc.Configuration {
+	config := webrtc.Configuration{ICEServers: servers}
+	if s.ice.TransportPolicy == "relay" {
+		config.ICETransportPolicy = webrtc.ICETransportPolicyRelay
+	}
+	return config
+}
+
+// candidateAllowed reports whether a candidate's type passes the filter;
+// candidate is the SDP candidate attribute, with or without the "a=" prefix
+func (s *TrustDiaryService) candidateAllowed(candidate string) bool {
+	if len(s.ice.CandidateTypes) == 0 {
+		return true
+	}
+	fields := strings.Fields(candidate)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "typ" {
+			for _, t := range s.ice.CandidateTypes {
+				if fields[i+1] == t {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return false
+}
+
+// relayPeerAllowed reports whether the embedded relay may forward to ip.
+// Loopback, link-local and other non-routable addresses are always refused
+// so the relay cannot be used to reach the host; private addresses are
+// refused unless they fall in one of the allowed ranges
+func relayPeerAllowed(ip net.IP, allowPrivate []*net.IPNet) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	return !ip.IsPrivate() || containsIP(allowPrivate, ip)
+}
+
+// startTURNServer runs the embedded relay
+func startTURNServer(t *TURNServerConfig) (*turn.Server, error) {
+	conn, err := net.ListenPacket("udp4", t.listenAddr())
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for TURN: %w", err)
+	}
+
+	realm := t.Realm
+	if realm == "" {
+		realm = "trust-diary"
+	}
+
+	keys := make(map[string][]byte, len(t.Users))
+	for user, pass := range t.Users {
+		keys[user] = turn.GenerateAuthKey(user, realm, pass)
+	}
+	allowPeers := parseCIDRs(t.AllowPeerCIDRs)
+
+	var timeWindowed turn.AuthHandler
+	if t.Secret != "" {
+		timeWindowed = turn.NewLongTermAuthHandler(t.Secret, nil)
+	}
+
+	var relay turn.RelayAddressGenerator = &turn.RelayAddressGeneratorStatic{
+		RelayAddress: net.ParseIP(t.PublicIP),
+		Address:      "0.0.0.0",
+	}
+	if t.RelayPortMin > 0 {
+		relay = &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: net.ParseIP(t.PublicIP),
+			Address:      "0.0.0.0",
+			MinPort:      t.RelayPortMin,
+			MaxPort:      t.RelayPortMax,
+		}
+	}
+
+	server, err := turn.NewServer(turn.ServerConfig{
+		Realm: realm,
+		AuthHandler: func(username, realm string, srcAddr net.Addr) ([]byte, bool) {
+			if key, ok := keys[username]; ok {
+				return key, true
+			}
+			if timeWindowed != nil {
+				return timeWindowed(username, realm, srcAddr)
+			}
+			return nil, false
+		},
+		PacketConnConfigs: []turn.PacketConnConfig{{
+			PacketConn:            conn,
+			RelayAddressGenerator: relay,
+			PermissionHandler: func(clientAddr net.Addr, peerIP net.IP) bool {
+				if !relayPeerAllowed(peerIP, allowPeers) {
+					log.Printf("⛔ TURN permission for %s refused (requested by %s)", peerIP, clientAddr)
+					return false
+				}
+				return true
+			},
+		}},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start TURN server: %w", err)
+	}
+
+	log.Printf("🔁 Embedded TURN relay on %s (public %s)", t.listenAddr(), t.PublicIP)
+	return server, nil
+}
+
+// setupICE builds the WebRTC API and starts the embedded relay if configured
+func (s *TrustDiaryService) setupICE() error {
+	api, err := newWebRTCAPI(s.ice)
+	if err != nil {
+		return err
+	}
+	s.webrtcAPI = api
+
+	if s.ice.TURN != nil {
+		if s.turnServer, err = startTURNServer(s.ice.TURN); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRelayPeerAllowed(t *testing.T) {
+	lan := parseCIDRs([]string{"192.168.1.0/24", "fd00::/8", "127.0.0.0/8", "169.254.0.0/16"})
+
+	tests := []struct {
+		ip    string
+		allow []*net.IPNet
+		want  bool
+	}{
+		{"203.0.113.7", nil, true},
+		{"2001:db8::1", nil, true},
+		{"192.168.1.20", nil, false},
+		{"10.0.0.1", nil, false},
+		{"192.168.1.20", lan, true},
+		{"192.168.2.20", lan, false},
+		{"fd12::1", lan, true},
+		{"127.0.0.1", nil, false},
+		{"::1", nil, false},
+		{"0.0.0.0", nil, false},
+		{"169.254.169.254", nil, false},
+		{"224.0.0.1", nil, false},
+		// Loopback and link-local stay blocked even when a range covers them
+		{"127.0.0.1", lan, false},
+		{"169.254.169.254", lan, false},
+	}
+	for _, tt := range tests {
+		if got := relayPeerAllowed(net.ParseIP(tt.ip), tt.allow); got != tt.want {
+			t.Errorf("relayPeerAllowed(%s, %d ranges) = %v, want %v", tt.ip, len(tt.allow), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// storedIdentity is the on-disk layout of identity.json; private keys are
+// either stored in the clear or inside a passphrase-sealed envelope
+type storedIdentity struct {
+	PublicKey     string      `json:"publicKey"`
+	PrivateKey    string      `json:"privateKey,omitempty"`
+	BoxPublicKey  string      `json:"boxPublicKey"`
+	BoxPrivateKey string      `json:"boxPrivateKey,omitempty"`
+	Sealed        *SealedFile `json:"sealed,omitempty"`
+	CreatedAt     string      `json:"createdAt,omitempty"`
+}
+
+// identitySecrets is the plaintext inside a sealed identity
+type identitySecrets struct {
+	PrivateKey    string `json:"privateKey"`
+	BoxPrivateKey string `json:"boxPrivateKey"`
+}
+
+// generateIdentity creates fresh signing and box key pairs
+func generateIdentity() (*Identity, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ed25519 keys: %w", err)
+	}
+
+	boxPub, boxPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate box keys: %w", err)
+	}
+
+	return &Identity{
+		PublicKey:     pub,
+		PrivateKey:    priv,
+		BoxPublicKey:  *boxPub,
+		BoxPrivateKey: *boxPriv,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// decodeIdentity turns a stored identity into keys, unsealing it if needed
+func (s *TrustDiaryService) decodeIdentity(stored *storedIdentity) (*Identity, error) {
+	secrets := identitySecrets{
+		PrivateKey:    stored.PrivateKey,
+		BoxPrivateKey: stored.BoxPrivateKey,
+	}
+
+	if stored.Sealed != nil {
+		if s.identityPassphrase == "" {
+			passphrase, err := promptPassphrase("Identity passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			s.identityPassphrase = passphrase
+		}
+
+		c, err := newPassphraseCipher(s.identityPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := c.open(stored.Sealed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unlock identity: %w", err)
+		}
+		if err := json.Unmarshal(plaintext, &secrets); err != nil {
+			return nil, fmt.Errorf("failed to parse sealed identity: %w", err)
+		}
+	}
+
+	pubKey, err := base64.StdEncoding.DecodeString(stored.PublicKey)
+	if err != nil || len(pubKey) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key in identity")
+	}
+	privKey, err := base64.StdEncoding.DecodeString(secrets.PrivateKey)
+	if err != nil || len(privKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid private key in identity")
+	}
+	boxPubKey, _ := base64.StdEncoding.DecodeString(stored.BoxPublicKey)
+	boxPrivKey, _ := base64.StdEncoding.DecodeString(secrets.BoxPrivateKey)
+
+	identity := &Identity{
+		PublicKey:  ed25519.PublicKey(pubKey),
+		PrivateKey: ed25519.PrivateKey(privKey),
+	}
+	copy(identity.BoxPublicKey[:], boxPubKey)
+	copy(identity.BoxPrivateKey[:], boxPrivKey)
+	identity.CreatedAt, _ = time.Parse(time.RFC3339, stored.CreatedAt)
+
+	return identity, nil
+}
+
+// saveIdentity writes identity.json, sealing the private keys when a passphrase is set
+func (s *TrustDiaryService) saveIdentity() error {
+	secrets := identitySecrets{
+		PrivateKey:    base64.StdEncoding.EncodeToString(s.identity.PrivateKey),
+		BoxPrivateKey: base64.StdEncoding.EncodeToString(s.identity.BoxPrivateKey[:]),
+	}
+
+	stored := storedIdentity{
+		PublicKey:    base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+		BoxPublicKey: base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
+		CreatedAt:    s.identity.CreatedAt.Format(time.RFC3339),
+	}
+
+	if s.identityPassphrase == "" {
+		stored.PrivateKey = secrets.PrivateKey
+		stored.BoxPrivateKey = secrets.BoxPrivateKey
+	} else {
+		plaintext, err := json.Marshal(secrets)
+		if err != nil {
+			return fmt.Errorf("failed to marshal identity secrets: %w", err)
+		}
+		c, err := newPassphraseCipher(s.identityPassphrase)
+		if err != nil {
+			return err
+		}
+		if stored.Sealed, err = c.seal(plaintext); err != nil {
+			return fmt.Errorf("failed to seal identity: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity: %w", err)
+	}
+
+	identityPath := filepath.Join(s.dataDir, "identity.json")
+	if err := writeFileAtomic(identityPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save identity: %w", err)
+	}
+	return nil
+}
+
+// changeIdentityPassphrase unlocks the identity and re-seals it under a new passphrase
+func (s *TrustDiaryService) changeIdentityPassphrase() error {
+	if err := s.loadOrGenerateIdentity(); err != nil {
+		return err
+	}
+
+	newPassphrase, err := passphraseFromEnv("NEW_IDENTITY_PASSPHRASE")
+	if err != nil {
+		return err
+	}
+	if newPassphrase == "" {
+		if newPassphrase, err = promptPassphrase("New passphrase: "); err != nil {
+			return err
+		}
+		confirm, err := promptPassphrase("Repeat new passphrase: ")
+		if err != nil {
+			return err
+		}
+		if confirm != newPassphrase {
+			return errors.New("passphrases do not match")
+		}
+	}
+	if newPassphrase == "" {
+		return errors.New("new passphrase must not be empty")
+	}
+
+	s.identityPassphrase = newPassphrase
+	if err := s.saveIdentity(); err != nil {
+		return err
+	}
+
+	log.Println("🔐 Identity re-sealed with new passphrase")
+	return nil
+}
+
+// passphraseFromEnv reads a passphrase from NAME or from the file named by NAME_FILE
+func passphraseFromEnv(name string) (string, error) {
+	if passphrase := os.Getenv(name); passphrase != "" {
+		return passphrase, nil
+	}
+
+	if path := os.Getenv(name + "_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	return "", nil
+}
+
+// stdinReader is shared so successive prompts don't lose buffered input
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptPassphrase reads a passphrase line from stdin
+func promptPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
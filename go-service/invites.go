@@ -0,0 +1,312 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// inviteDefaultTTL is how long an invite is valid when no expiry is given
+	inviteDefaultTTL = 24 * time.Hour
+	// inviteDomain separates invite signatures from other uses of the key
+	inviteDomain = "trust-diary-invite-v1:"
+)
+
+var (
+	errInviteInvalid = errors.New("invalid invite")
+	errInviteExpired = errors.New("invite expired")
+	errInviteUsedUp  = errors.New("invite already used")
+	errNameRequired  = errors.New("a name is required")
+	errNameTaken     = errors.New("name already belongs to another user")
+)
+
+// Invite is a one-time (or n-time) enrollment grant
+type Invite struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name,omitempty"`
+	Permissions []string  `json:"permissions"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	MaxUses     int       `json:"maxUses"`
+	Uses        int       `json:"uses"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Revoked     bool      `json:"revoked,omitempty"`
+}
+
+// invitePayload is the signed part of an invite token. ServicePublicKey
+// lets the reader pin the service key it will verify the handshake against
+type invitePayload struct {
+	ID               string `json:"id"`
+	ExpiresAt        int64  `json:"exp"`
+	ServicePublicKey string `json:"svc,omitempty"`
+}
+
+// loadInvites loads invites from the store
+func (s *TrustDiaryService) loadInvites() error {
+	invites, err := s.store.LoadInvites()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range invites {
+		s.invites[invites[i].ID] = &invites[i]
+	}
+	return nil
+}
+
+// saveInvites saves invites to the store; the caller holds s.mu
+func (s *TrustDiaryService) saveInvitesLocked() error {
+	invites := make([]Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		invites = append(invites, *invite)
+	}
+	return s.store.SaveInvites(invites)
+}
+
+// signInvite builds the token handed to the invited reader
+func (s *TrustDiaryService) signInvite(invite *Invite) (string, error) {
+	payload, err := json.Marshal(invitePayload{
+		ID:               invite.ID,
+		ExpiresAt:        invite.ExpiresAt.Unix(),
+		ServicePublicKey: base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sig := ed25519.Sign(s.identity.PrivateKey, append([]byte(inviteDomain), payload...))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseInviteToken verifies the service signature on a token
+func (s *TrustDiaryService) parseInviteToken(token string) (*invitePayload, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, errInviteInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInviteInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInviteInvalid
+	}
+
+	if !ed25519.Verify(s.identity.PublicKey, append([]byte(inviteDomain), payload...), sig) {
+		return nil, errInviteInvalid
+	}
+
+	var parsed invitePayload
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, errInviteInvalid
+	}
+	return &parsed, nil
+}
+
+// redeemInvite enrolls a reader's keys as a trusted user if the invite is
+// still valid, consuming one use
+func (s *TrustDiaryService) redeemInvite(token, pubKeyStr, boxPubKeyStr, name string) (*TrustedUser, error) {
+	payload, err := s.parseInviteToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > payload.ExpiresAt {
+		return nil, errInviteExpired
+	}
+
+	s.mu.Lock()
+	invite := s.invites[payload.ID]
+	switch {
+	case invite == nil || invite.Revoked:
+		s.mu.Unlock()
+		return nil, errInviteInvalid
+	case time.Now().After(invite.ExpiresAt):
+		s.mu.Unlock()
+		return nil, errInviteExpired
+	case invite.Uses >= invite.MaxUses:
+		s.mu.Unlock()
+		return nil, errInviteUsedUp
+	}
+
+	// The admin's choice of name wins; otherwise the reader picks one that
+	// nobody else, including the service itself, already goes by
+	if invite.Name != "" {
+		name = invite.Name
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		s.mu.Unlock()
+		return nil, errNameRequired
+	}
+	if s.nameTakenLocked(name, pubKeyStr) {
+		s.mu.Unlock()
+		return nil, errNameTaken
+	}
+	user := &TrustedUser{
+		PublicKey:    pubKeyStr,
+		BoxPublicKey: boxPubKeyStr,
+		Name:         name,
+		Permissions:  append([]string(nil), invite.Permissions...),
+		TrustedAt:    time.Now(),
+	}
+	invite.Uses++
+	s.trustedUsers[pubKeyStr] = user
+	err = s.saveInvitesLocked()
+	trustedErr := s.saveTrustedUsersLocked()
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Failed to save invites: %v", err)
+	}
+	if trustedErr != nil {
+		log.Printf("Failed to save trusted users: %v", trustedErr)
+	}
+
+	s.events.Publish(EventTrustedAdded, map[string]interface{}{
+		"publicKey":   user.PublicKey,
+		"name":        user.Name,
+		"permissions": user.Permissions,
+		"invite":      invite.ID,
+	})
+	return user, nil
+}
+
+// nameTakenLocked reports whether a user other than the holder of pubKeyStr
+// goes by name; the caller holds s.mu
+func (s *TrustDiaryService) nameTakenLocked(name, pubKeyStr string) bool {
+	if strings.EqualFold(name, localAdmin.Name) {
+		return true
+	}
+	for key, user := range s.trustedUsers {
+		if key != pubKeyStr && strings.EqualFold(user.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCreateInvite mints a signed invite token
+func (s *TrustDiaryService) handleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+		ExpiresIn   int      `json:"expiresIn"`
+		MaxUses     int      `json:"maxUses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Permissions == nil {
+		req.Permissions = []string{PermRead}
+	}
+	if err := validatePermissions(req.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses <= 0 {
+		req.MaxUses = 1
+	}
+	ttl := inviteDefaultTTL
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	invite := &Invite{
+		ID:          hex.EncodeToString(idBytes),
+		Name:        req.Name,
+		Permissions: req.Permissions,
+		ExpiresAt:   time.Now().Add(ttl),
+		MaxUses:     req.MaxUses,
+		CreatedAt:   time.Now(),
+	}
+
+	token, err := s.signInvite(invite)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.invites[invite.ID] = invite
+	err = s.saveInvitesLocked()
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to save invite: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("✉️ Created invite %s (%d uses, expires %s)", invite.ID[:8], invite.MaxUses, invite.ExpiresAt.Format(time.RFC3339))
+	s.recordAudit(AuditRecord{
+		Action: AuditInviteCreated,
+		Name:   invite.Name,
+		Actor:  auditActor(r),
+		Detail: fmt.Sprintf("invite %s: %s, %d uses", invite.ID[:8], strings.Join(invite.Permissions, ","), invite.MaxUses),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"invite":           invite,
+		"token":            token,
+		"servicePublicKey": base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+		"roomId":           s.roomID,
+	})
+}
+
+// handleGetInvites lists invites
+func (s *TrustDiaryService) handleGetInvites(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	invites := make([]Invite, 0, len(s.invites))
+	for _, invite := range s.invites {
+		invites = append(invites, *invite)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invites)
+}
+
+// handleRevokeInvite stops an invite from being redeemed
+func (s *TrustDiaryService) handleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	invite := s.invites[id]
+	var err error
+	if invite != nil {
+		invite.Revoked = true
+		err = s.saveInvitesLocked()
+	}
+	s.mu.Unlock()
+
+	if invite == nil {
+		http.Error(w, "invite not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save invites: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"success": true})
+}
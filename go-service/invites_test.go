@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRedeemInviteName(t *testing.T) {
+	tests := []struct {
+		name       string
+		inviteName string
+		peerName   string
+		want       string
+		err        error
+	}{
+		{"invite name wins", "Bob", "Mallory", "Bob", nil},
+		{"reader picks a name", "", "Carol", "Carol", nil},
+		{"no name at all", "", "  ", "", errNameRequired},
+		{"another reader's name", "", "alice", "", errNameTaken},
+		{"the service's own name", "", "Admin", "", errNameTaken},
+		{"admin reuses a taken name", "Alice", "", "", errNameTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			s.store = newJSONStore(t.TempDir(), testCipher(t))
+			s.trustedUsers["alice-key"] = &TrustedUser{PublicKey: "alice-key", Name: "Alice", Permissions: []string{PermRead}}
+			invite := &Invite{
+				ID:          "invite",
+				Name:        tt.inviteName,
+				Permissions: []string{PermRead},
+				ExpiresAt:   time.Now().Add(time.Hour),
+				MaxUses:     1,
+			}
+			s.invites[invite.ID] = invite
+			token, err := s.signInvite(invite)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := s.redeemInvite(token, "reader-key", "", tt.peerName)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if invite.Uses != 0 || s.trustedUsers["reader-key"] != nil {
+					t.Fatal("rejected redemption used the invite or enrolled the key")
+				}
+				return
+			}
+			if user.Name != tt.want {
+				t.Fatalf("enrolled as %q, want %q", user.Name, tt.want)
+			}
+		})
+	}
+}
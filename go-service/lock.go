@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// errDataDirLocked means another process holds the data directory lock
+var errDataDirLocked = errors.New("data directory is in use by another process")
+
+// dataDirLock is an exclusive lock on a data directory, held by the running
+// service and by commands that rewrite its files, so a key rotation cannot
+// re-seal storage underneath a live service
+type dataDirLock struct {
+	file *os.File
+	path string
+}
+
+// lockPath is the lock file guarding dataDir
+func lockPath(dataDir string) string {
+	return filepath.Join(dataDir, ".lock")
+}
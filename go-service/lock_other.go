@@ -0,0 +1,29 @@
+//go:build !unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockDataDir takes the data directory lock by creating the lock file
+// exclusively. Without flock a crashed process leaves the file behind; it
+// has to be removed by hand once no service is running
+func lockDataDir(dataDir string) (*dataDirLock, error) {
+	path := lockPath(dataDir)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w (remove %s if no service is running)", errDataDirLocked, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	return &dataDirLock{file: f, path: path}, nil
+}
+
+// Release drops the lock
+func (l *dataDirLock) Release() error {
+	l.file.Close()
+	return os.Remove(l.path)
+}
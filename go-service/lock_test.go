@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDataDirLock(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := lockDataDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockDataDir(dir); !errors.Is(err, errDataDirLocked) {
+		t.Fatalf("second lock: %v, want errDataDirLocked", err)
+	}
+
+	// A running service blocks key rotation
+	s := NewTrustDiaryService(dir, 0)
+	if err := s.rotateIdentity("test"); !errors.Is(err, errDataDirLocked) {
+		t.Fatalf("rotateIdentity while locked: %v", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+	again, err := lockDataDir(dir)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	again.Release()
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockDataDir takes the data directory lock without waiting. The kernel
+// drops it if the process dies, so a crash never leaves a stale lock
+func lockDataDir(dataDir string) (*dataDirLock, error) {
+	path := lockPath(dataDir)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errDataDirLocked
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &dataDirLock{file: f, path: path}, nil
+}
+
+// Release drops the lock
+func (l *dataDirLock) Release() error {
+	return l.file.Close()
+}
@@ -6,24 +6,29 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/pion/turn/v2"
 	"github.com/pion/webrtc/v3"
-	"golang.org/x/crypto/nacl/box"
 )
 
 // TrustDiaryService represents the main service
 type TrustDiaryService struct {
 	identity      *Identity
+	keys          keyHistory
 	trustedUsers  map[string]*TrustedUser
+	invites       map[string]*Invite
 	entries       []DiaryEntry
 	connections   map[string]*Connection
 	peerConns     map[string]*webrtc.PeerConnection
@@ -33,15 +38,37 @@ type TrustDiaryService struct {
 	port          int
 	roomSalt      string
 	roomID        string
+	adminAuthMode string
+	signedRequests replayCache
+	chainBreakPolicy string
+	migrateLegacy bool
+	allowUnboundAuth bool
+	cipher        *storageCipher
+	store         Store
+	storageBackend string
+	search        *searchIndex
+	events        *eventBus
+	audit         *auditLog
+	auditMaxBytes int64
+	auditRetention time.Duration
+	storagePassphrase string
+	identityPassphrase string
 	wsUpgrader    websocket.Upgrader
+	ice           ICEConfig
+	webrtcAPI     *webrtc.API
+	turnServer    *turn.Server
+	dataLock      *dataDirLock
 }
 
+var errNoTrustedUsers = errors.New("no trusted users found")
+
 // Identity represents the service's cryptographic identity
 type Identity struct {
 	PublicKey    ed25519.PublicKey    `json:"publicKey"`
 	PrivateKey   ed25519.PrivateKey   `json:"-"`
 	BoxPublicKey [32]byte             `json:"boxPublicKey"`
 	BoxPrivateKey [32]byte            `json:"-"`
+	CreatedAt    time.Time            `json:"createdAt"`
 }
 
 // TrustedUser represents a user trusted by the service
@@ -51,14 +78,27 @@ type TrustedUser struct {
 	Name         string    `json:"name"`
 	Permissions  []string  `json:"permissions"`
 	TrustedAt    time.Time `json:"trustedAt"`
+	NotBefore    *time.Time `json:"notBefore,omitempty"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	SuspendedUntil *time.Time `json:"suspendedUntil,omitempty"`
 }
 
 // DiaryEntry represents a single diary entry
 type DiaryEntry struct {
-	ID        int       `json:"id"`
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
-	Author    string    `json:"author"`
+	ID        int        `json:"id"`
+	Content   string     `json:"content"`
+	Timestamp time.Time  `json:"timestamp"`
+	Author    string     `json:"author"`
+	AuthorKey string     `json:"authorKey,omitempty"`
+	ReplyTo   int        `json:"replyTo,omitempty"`
+	Kind      string     `json:"kind,omitempty"`
+	Target    int        `json:"target,omitempty"`
+	Signature string     `json:"signature,omitempty"`
+	SignedBy  string     `json:"signedBy,omitempty"`
+	PrevHash  string     `json:"prevHash,omitempty"`
+	Hash      string     `json:"hash,omitempty"`
+	Revision  int        `json:"revision,omitempty"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
 }
 
 // Connection represents an active P2P connection
@@ -68,7 +108,9 @@ type Connection struct {
 	PublicKey    string
 	Name         string
 	Challenge    []byte
+	ChallengeExpires time.Time
 	Authenticated bool
+	SharedKey    *[32]byte
 }
 
 // WebRTC offer/answer messages
@@ -76,19 +118,27 @@ type SignalMessage struct {
 	Type      string                     `json:"type"`
 	SDP       string                     `json:"sdp,omitempty"`
 	Candidate *webrtc.ICECandidateInit   `json:"candidate,omitempty"`
+	ICEServers []webrtc.ICEServer        `json:"iceServers,omitempty"`
 }
 
 // NewTrustDiaryService creates a new service instance
 func NewTrustDiaryService(dataDir string, port int) *TrustDiaryService {
 	return &TrustDiaryService{
 		trustedUsers:  make(map[string]*TrustedUser),
+		invites:       make(map[string]*Invite),
 		entries:       []DiaryEntry{},
+		search:        newSearchIndex(),
+		events:        newEventBus(),
+		auditMaxBytes: auditDefaultMaxBytes,
+		auditRetention: auditDefaultRetention,
 		connections:   make(map[string]*Connection),
 		peerConns:     make(map[string]*webrtc.PeerConnection),
 		dataChannels:  make(map[string]*webrtc.DataChannel),
 		dataDir:       dataDir,
 		port:          port,
 		roomSalt:      "trust-diary-v1",
+		adminAuthMode: AdminAuthSigned,
+		chainBreakPolicy: ChainBreakRefuse,
 		wsUpgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for demo
@@ -106,24 +156,69 @@ func (s *TrustDiaryService) Initialize() error {
 		return fmt.Errorf("failed to create data dir: %w", err)
 	}
 
+	// Held for the life of the process; rotate-key refuses to run meanwhile
+	lock, err := lockDataDir(s.dataDir)
+	if err != nil {
+		return err
+	}
+	s.dataLock = lock
+
 	// Load or generate identity
 	if err := s.loadOrGenerateIdentity(); err != nil {
 		return fmt.Errorf("failed to load identity: %w", err)
 	}
 
-	// Load trusted users
-	if err := s.loadTrustedUsers(); err != nil {
+	// Load retired keys and rollovers
+	if err := s.loadKeyHistory(); err != nil {
+		return err
+	}
+
+	// Set up encryption for data at rest
+	if err := s.initStorageCipher(); err != nil {
+		return fmt.Errorf("failed to set up storage encryption: %w", err)
+	}
+
+	// Open the audit log
+	audit, err := openAuditLog(s.dataDir, s.cipher, s.auditMaxBytes, s.auditRetention)
+	if err != nil {
+		return err
+	}
+	s.audit = audit
+
+	// Open the storage backend
+	store, err := s.openStore()
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	s.store = store
+
+	// Load trusted users; unreadable (rather than missing) data is fatal so
+	// it is never overwritten by an empty list
+	if err := s.loadTrustedUsers(); err == errNoTrustedUsers {
 		log.Printf("Warning: %v", err)
+	} else if err != nil {
+		return err
+	}
+
+	// Load pending invites
+	if err := s.loadInvites(); err != nil {
+		return err
 	}
 
 	// Load entries
 	if err := s.loadEntries(); err != nil {
-		log.Printf("Warning: %v", err)
+		return err
 	}
+	s.rebuildSearchIndex()
 
 	// Generate room ID
 	s.roomID = s.generateRoomID()
 
+	// Set up ICE and the embedded TURN relay
+	if err := s.setupICE(); err != nil {
+		return err
+	}
+
 	log.Printf("✅ Service initialized")
 	log.Printf("📍 Admin UI: http://localhost:%d", s.port)
 	log.Printf("🔑 Service Public Key: %s...", base64.StdEncoding.EncodeToString(s.identity.PublicKey)[:32])
@@ -138,155 +233,129 @@ func (s *TrustDiaryService) loadOrGenerateIdentity() error {
 
 	// Try to load existing identity
 	if data, err := os.ReadFile(identityPath); err == nil {
-		var stored struct {
-			PublicKey    string `json:"publicKey"`
-			PrivateKey   string `json:"privateKey"`
-			BoxPublicKey string `json:"boxPublicKey"`
-			BoxPrivateKey string `json:"boxPrivateKey"`
-		}
-
+		var stored storedIdentity
 		if err := json.Unmarshal(data, &stored); err != nil {
 			return fmt.Errorf("failed to parse identity: %w", err)
 		}
 
-		// Decode keys
-		pubKey, _ := base64.StdEncoding.DecodeString(stored.PublicKey)
-		privKey, _ := base64.StdEncoding.DecodeString(stored.PrivateKey)
-		boxPubKey, _ := base64.StdEncoding.DecodeString(stored.BoxPublicKey)
-		boxPrivKey, _ := base64.StdEncoding.DecodeString(stored.BoxPrivateKey)
+		identity, err := s.decodeIdentity(&stored)
+		if err != nil {
+			return err
+		}
+		s.identity = identity
 
-		s.identity = &Identity{
-			PublicKey:  ed25519.PublicKey(pubKey),
-			PrivateKey: ed25519.PrivateKey(privKey),
+		// Seal a plaintext identity as soon as a passphrase is configured
+		if stored.Sealed == nil && s.identityPassphrase != "" {
+			if err := s.saveIdentity(); err != nil {
+				return fmt.Errorf("failed to seal identity: %w", err)
+			}
+			log.Println("🔒 Sealed existing identity with passphrase")
 		}
-		copy(s.identity.BoxPublicKey[:], boxPubKey)
-		copy(s.identity.BoxPrivateKey[:], boxPrivKey)
 
 		log.Println("📂 Loaded existing identity")
 		return nil
 	}
 
 	// Generate new identity
-	pub, priv, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return fmt.Errorf("failed to generate ed25519 keys: %w", err)
-	}
-
-	boxPub, boxPriv, err := box.GenerateKey(rand.Reader)
+	identity, err := generateIdentity()
 	if err != nil {
-		return fmt.Errorf("failed to generate box keys: %w", err)
-	}
-
-	s.identity = &Identity{
-		PublicKey:     pub,
-		PrivateKey:    priv,
-		BoxPublicKey:  *boxPub,
-		BoxPrivateKey: *boxPriv,
+		return err
 	}
+	s.identity = identity
 
-	// Save identity
-	stored := map[string]string{
-		"publicKey":     base64.StdEncoding.EncodeToString(pub),
-		"privateKey":    base64.StdEncoding.EncodeToString(priv),
-		"boxPublicKey":  base64.StdEncoding.EncodeToString(boxPub[:]),
-		"boxPrivateKey": base64.StdEncoding.EncodeToString(boxPriv[:]),
-		"createdAt":     time.Now().Format(time.RFC3339),
-	}
-
-	data, err := json.MarshalIndent(stored, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal identity: %w", err)
-	}
-
-	if err := os.WriteFile(identityPath, data, 0600); err != nil {
-		return fmt.Errorf("failed to save identity: %w", err)
+	if err := s.saveIdentity(); err != nil {
+		return err
 	}
 
 	log.Println("🔐 Generated new identity")
 	return nil
 }
 
-// loadTrustedUsers loads trusted users from disk
-func (s *TrustDiaryService) loadTrustedUsers() error {
-	trustedPath := filepath.Join(s.dataDir, "trusted.json")
+// initStorageCipher picks the key used to encrypt entries and trusted users on disk
+func (s *TrustDiaryService) initStorageCipher() error {
+	var err error
+	if s.storagePassphrase != "" {
+		s.cipher, err = newPassphraseCipher(s.storagePassphrase)
+		log.Println("🔒 Storage encrypted with passphrase-derived key")
+	} else {
+		s.cipher, err = newIdentityCipher(s.identity)
+		log.Println("🔒 Storage encrypted with identity-derived key")
+	}
+	return err
+}
 
-	data, err := os.ReadFile(trustedPath)
+// loadTrustedUsers loads trusted users from the store
+func (s *TrustDiaryService) loadTrustedUsers() error {
+	trusted, err := s.store.LoadTrustedUsers()
 	if err != nil {
-		return fmt.Errorf("no trusted users found")
+		return err
 	}
-
-	var trusted []TrustedUser
-	if err := json.Unmarshal(data, &trusted); err != nil {
-		return fmt.Errorf("failed to parse trusted users: %w", err)
+	if len(trusted) == 0 {
+		return errNoTrustedUsers
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for _, user := range trusted {
-		s.trustedUsers[user.PublicKey] = &user
+	for i := range trusted {
+		s.trustedUsers[trusted[i].PublicKey] = &trusted[i]
 	}
 
 	log.Printf("👥 Loaded %d trusted users", len(s.trustedUsers))
 	return nil
 }
 
-// saveTrustedUsers saves trusted users to disk
-func (s *TrustDiaryService) saveTrustedUsers() error {
-	s.mu.RLock()
+// saveTrustedUsersLocked saves trusted users to the store; the caller holds
+// s.mu so concurrent changes reach the disk in the order they were made
+func (s *TrustDiaryService) saveTrustedUsersLocked() error {
 	trusted := make([]TrustedUser, 0, len(s.trustedUsers))
 	for _, user := range s.trustedUsers {
 		trusted = append(trusted, *user)
 	}
-	s.mu.RUnlock()
-
-	data, err := json.MarshalIndent(trusted, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal trusted users: %w", err)
-	}
-
-	trustedPath := filepath.Join(s.dataDir, "trusted.json")
-	return os.WriteFile(trustedPath, data, 0644)
+	return s.store.SaveTrustedUsers(trusted)
 }
 
-// loadEntries loads diary entries from disk
+// loadEntries loads diary entries from the store
 func (s *TrustDiaryService) loadEntries() error {
-	entriesPath := filepath.Join(s.dataDir, "entries.json")
-
-	data, err := os.ReadFile(entriesPath)
+	entries, err := s.store.LoadEntries()
 	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
 		// Create initial entry
-		s.entries = []DiaryEntry{
-			{
-				ID:        1,
-				Content:   "Trust Diary Service started",
-				Timestamp: time.Now(),
-				Author:    "Service",
-			},
+		entry := DiaryEntry{
+			ID:        1,
+			Content:   "Trust Diary Service started",
+			Timestamp: time.Now(),
+			Author:    "Service",
 		}
-		return s.saveEntries()
+		s.linkEntry(&entry, "")
+		s.entries = []DiaryEntry{entry}
+		return s.store.AppendEntry(entry)
 	}
 
-	if err := json.Unmarshal(data, &s.entries); err != nil {
-		return fmt.Errorf("failed to parse entries: %w", err)
+	entries, changed, err := s.checkEntryChain(entries)
+	if err != nil {
+		return err
 	}
+	s.entries = entries
 
-	log.Printf("📝 Loaded %d entries", len(s.entries))
-	return nil
-}
-
-// saveEntries saves diary entries to disk
-func (s *TrustDiaryService) saveEntries() error {
-	s.mu.RLock()
-	data, err := json.MarshalIndent(s.entries, "", "  ")
-	s.mu.RUnlock()
+	// A plaintext log is sealed only now that its chain has been checked, so
+	// a refused log is left exactly as it was found
+	if _, err := s.store.ReadEntries(); errors.Is(err, errUnsealedEntries) {
+		log.Printf("🔒 Sealing plaintext entry log")
+		changed = true
+	}
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal entries: %w", err)
+	if changed {
+		if err := s.store.ReplaceEntries(entries); err != nil {
+			return err
+		}
 	}
 
-	entriesPath := filepath.Join(s.dataDir, "entries.json")
-	return os.WriteFile(entriesPath, data, 0644)
+	log.Printf("📝 Loaded %d entries (head %.12s)", len(s.entries), s.lastHash())
+	return nil
 }
 
 // generateRoomID generates a deterministic room ID from service public key
@@ -307,19 +376,41 @@ func (s *TrustDiaryService) StartHTTPServer() error {
 		http.Redirect(w, r, "/admin/", http.StatusFound)
 	})
 
-	// API endpoints
-	router.HandleFunc("/api/status", s.handleStatus).Methods("GET")
-	router.HandleFunc("/api/entries", s.handleGetEntries).Methods("GET")
-	router.HandleFunc("/api/entries", s.handleAddEntry).Methods("POST")
-	router.HandleFunc("/api/trusted", s.handleGetTrusted).Methods("GET")
-	router.HandleFunc("/api/trusted", s.handleAddTrusted).Methods("POST")
-	router.HandleFunc("/api/trusted/{key}", s.handleRemoveTrusted).Methods("DELETE")
+	// API endpoints, all behind admin authentication
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(s.adminAuthMiddleware)
+	api.HandleFunc("/session", s.handleCreateSession).Methods("POST")
+	api.HandleFunc("/status", s.requirePermission(PermAdmin, s.handleStatus)).Methods("GET")
+	api.HandleFunc("/events", s.requirePermission(PermAdmin, s.handleEvents)).Methods("GET")
+	api.HandleFunc("/entries", s.requirePermission(PermRead, s.handleGetEntries)).Methods("GET")
+	api.HandleFunc("/entries", s.requirePermission(PermWrite, s.handleAddEntry)).Methods("POST")
+	api.HandleFunc("/entries/verify", s.requirePermission(PermAdmin, s.handleVerifyEntries)).Methods("GET")
+	api.HandleFunc("/entries/{id:[0-9]+}", s.requirePermission(PermWrite, s.handleUpdateEntry)).Methods("PUT")
+	api.HandleFunc("/entries/{id:[0-9]+}", s.requirePermission(PermWrite, s.handleDeleteEntry)).Methods("DELETE")
+	api.HandleFunc("/entries/{id:[0-9]+}/revisions", s.requirePermission(PermRead, s.handleGetRevisions)).Methods("GET")
+	api.HandleFunc("/search", s.requirePermission(PermRead, s.handleSearch)).Methods("GET")
+	api.HandleFunc("/trusted", s.requirePermission(PermAdmin, s.handleGetTrusted)).Methods("GET")
+	api.HandleFunc("/trusted", s.requirePermission(PermAdmin, s.handleAddTrusted)).Methods("POST")
+	api.HandleFunc("/trusted/{key}", s.requirePermission(PermAdmin, s.handleRemoveTrusted)).Methods("DELETE")
+	api.HandleFunc("/trusted/{key}/access", s.requirePermission(PermAdmin, s.handleUpdateAccess)).Methods("PATCH")
+	api.HandleFunc("/keys", s.requirePermission(PermAdmin, s.handleGetKeys)).Methods("GET")
+	api.HandleFunc("/audit", s.requirePermission(PermAdmin, s.handleGetAudit)).Methods("GET")
+	api.HandleFunc("/invites", s.requirePermission(PermAdmin, s.handleGetInvites)).Methods("GET")
+	api.HandleFunc("/invites", s.requirePermission(PermAdmin, s.handleCreateInvite)).Methods("POST")
+	api.HandleFunc("/invites/{id}", s.requirePermission(PermAdmin, s.handleRevokeInvite)).Methods("DELETE")
 
 	// WebRTC signaling
 	router.HandleFunc("/ws/signal", s.handleWebSocketSignaling)
 
-	// Start server
+	// Disconnect sessions whose access lapses
+	go s.sweepAccess()
+
+	// Start server; localhost mode never listens beyond loopback
 	addr := fmt.Sprintf(":%d", s.port)
+	if s.adminAuthMode == AdminAuthLocalhost {
+		addr = fmt.Sprintf("127.0.0.1:%d", s.port)
+		log.Printf("⚠️ Admin API is unauthenticated (localhost-only mode)")
+	}
 	log.Printf("🌐 Starting HTTP server on %s", addr)
 	return http.ListenAndServe(addr, router)
 }
@@ -336,6 +427,8 @@ func (s *TrustDiaryService) handleStatus(w http.ResponseWriter, r *http.Request)
 		"boxPublicKey":  base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
 		"trustedCount":  len(s.trustedUsers),
 		"entriesCount":  len(s.entries),
+		"chainHead":     s.lastHash(),
+		"previousRoomIds": s.previousRoomIDs(),
 		"connections":   s.getConnectionsStatus(),
 	}
 
@@ -356,13 +449,41 @@ func (s *TrustDiaryService) getConnectionsStatus() []map[string]string {
 	return conns
 }
 
-// handleGetEntries returns all entries
+// handleGetEntries returns a page of the current revision of live entries
 func (s *TrustDiaryService) handleGetEntries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEntryFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	head := s.lastHash()
+	s.mu.RUnlock()
+
+	etag := entriesETag(head, r.URL.RawQuery)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	page, next := filter.apply(s.currentEntries())
+	if next > 0 {
+		cursor := "after"
+		if filter.Descending {
+			cursor = "before"
+		}
+		params := r.URL.Query()
+		params.Del("before")
+		params.Del("after")
+		params.Set(cursor, strconv.Itoa(next))
+		w.Header().Set("X-Next-Cursor", strconv.Itoa(next))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, params.Encode()))
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.entries)
+	json.NewEncoder(w).Encode(page)
 }
 
 // handleAddEntry adds a new entry
@@ -376,27 +497,32 @@ func (s *TrustDiaryService) handleAddEntry(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	s.mu.Lock()
-	entry := DiaryEntry{
-		ID:        len(s.entries) + 1,
-		Content:   req.Content,
-		Timestamp: time.Now(),
-		Author:    "Admin",
-	}
-	s.entries = append(s.entries, entry)
-	s.mu.Unlock()
-
-	if err := s.saveEntries(); err != nil {
-		log.Printf("Failed to save entries: %v", err)
+	entry, err := s.addEntry(req.Content, principalFromRequest(r), 0)
+	if err != nil {
+		writeEntryError(w, err)
+		return
 	}
 
-	// Broadcast to connected peers
-	s.broadcastEntry(entry)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(entry)
 }
 
+// addEntry appends a new entry, persists it and pushes it to connected peers
+func (s *TrustDiaryService) addEntry(content string, author *TrustedUser, replyTo int) (DiaryEntry, error) {
+	return s.appendRecord(DiaryEntry{
+		Content:   content,
+		Author:    author.Name,
+		AuthorKey: author.PublicKey,
+		ReplyTo:   replyTo,
+	}, func() error {
+		if replyTo == 0 {
+			return nil
+		}
+		_, err := s.liveEntry(replyTo)
+		return err
+	})
+}
+
 // handleGetTrusted returns trusted users
 func (s *TrustDiaryService) handleGetTrusted(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
@@ -411,6 +537,21 @@ func (s *TrustDiaryService) handleGetTrusted(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(trusted)
 }
 
+// validateUserKeys checks a user's signing key and, if given, box key are
+// base64 keys of the right size
+func validateUserKeys(publicKey, boxPublicKey string) error {
+	if key, err := base64.StdEncoding.DecodeString(publicKey); err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("publicKey must be a base64 Ed25519 public key (%d bytes)", ed25519.PublicKeySize)
+	}
+	if boxPublicKey == "" {
+		return nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(boxPublicKey); err != nil || len(key) != 32 {
+		return errors.New("boxPublicKey must be a base64 X25519 public key (32 bytes)")
+	}
+	return nil
+}
+
 // handleAddTrusted adds a trusted user
 func (s *TrustDiaryService) handleAddTrusted(w http.ResponseWriter, r *http.Request) {
 	var user TrustedUser
@@ -419,19 +560,41 @@ func (s *TrustDiaryService) handleAddTrusted(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if err := validateUserKeys(user.PublicKey, user.BoxPublicKey); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if user.Permissions == nil {
-		user.Permissions = []string{"read"}
+		user.Permissions = []string{PermRead}
+	}
+	if err := validatePermissions(user.Permissions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 	user.TrustedAt = time.Now()
 
 	s.mu.Lock()
 	s.trustedUsers[user.PublicKey] = &user
+	err := s.saveTrustedUsersLocked()
 	s.mu.Unlock()
 
-	if err := s.saveTrustedUsers(); err != nil {
+	if err != nil {
 		log.Printf("Failed to save trusted users: %v", err)
 	}
 
+	s.events.Publish(EventTrustedAdded, map[string]interface{}{
+		"publicKey":   user.PublicKey,
+		"name":        user.Name,
+		"permissions": user.Permissions,
+	})
+	s.recordAudit(AuditRecord{
+		Action:      AuditTrustedAdded,
+		Fingerprint: keyFingerprint(user.PublicKey),
+		Name:        user.Name,
+		Actor:       auditActor(r),
+		Detail:      strings.Join(user.Permissions, ","),
+	})
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
@@ -442,13 +605,29 @@ func (s *TrustDiaryService) handleRemoveTrusted(w http.ResponseWriter, r *http.R
 	key := vars["key"]
 
 	s.mu.Lock()
+	var name string
+	if user := s.trustedUsers[key]; user != nil {
+		name = user.Name
+	}
 	delete(s.trustedUsers, key)
+	err := s.saveTrustedUsersLocked()
 	s.mu.Unlock()
 
-	if err := s.saveTrustedUsers(); err != nil {
+	if err != nil {
 		log.Printf("Failed to save trusted users: %v", err)
 	}
 
+	s.events.Publish(EventTrustedRemoved, map[string]string{"publicKey": key})
+	s.recordAudit(AuditRecord{
+		Action:      AuditTrustedRemoved,
+		Fingerprint: keyFingerprint(key),
+		Name:        name,
+		Actor:       auditActor(r),
+	})
+
+	// Sessions opened with the key end now rather than at disconnect
+	s.revokeSessions(key)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
@@ -465,16 +644,15 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 	peerID := fmt.Sprintf("%d", time.Now().UnixNano())
 	log.Printf("🔌 WebSocket connected: %s", peerID[:8])
 
-	// Create WebRTC peer connection
-	config := webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs: []string{"stun:stun.l.google.com:19302"},
-			},
-		},
+	// Tell the reader which ICE servers to use. The embedded relay is not
+	// included: its credentials are only handed out after authentication
+	if err := conn.WriteJSON(SignalMessage{Type: "config", ICEServers: s.iceServers()}); err != nil {
+		log.Printf("Failed to send ICE config: %v", err)
+		return
 	}
 
-	peerConnection, err := webrtc.NewPeerConnection(config)
+	// Create WebRTC peer connection
+	peerConnection, err := s.webrtcAPI.NewPeerConnection(s.peerConnectionConfig(s.serviceICEServers()))
 	if err != nil {
 		log.Printf("Failed to create peer connection: %v", err)
 		return
@@ -489,6 +667,8 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 	}
 	s.mu.Unlock()
 
+	s.events.Publish(EventPeerConnected, map[string]string{"peer": peerID[:8]})
+
 	// Handle ICE candidates
 	peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
 		if candidate == nil {
@@ -496,6 +676,9 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 		}
 
 		candidateJSON := candidate.ToJSON()
+		if !s.candidateAllowed(candidateJSON.Candidate) {
+			return
+		}
 		msg := SignalMessage{
 			Type:      "candidate",
 			Candidate: &candidateJSON,
@@ -527,7 +710,9 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 		dc.OnClose(func() {
 			s.mu.Lock()
 			delete(s.dataChannels, peerID)
-			s.connections[peerID].State = "disconnected"
+			if conn := s.connections[peerID]; conn != nil && conn.State != "lapsed" && conn.State != "revoked" && conn.State != "timeout" {
+				conn.State = "disconnected"
+			}
 			s.mu.Unlock()
 		})
 	})
@@ -546,7 +731,7 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 		case "answer":
 			s.handleAnswer(peerConnection, msg.SDP)
 		case "candidate":
-			if msg.Candidate != nil {
+			if msg.Candidate != nil && s.candidateAllowed(msg.Candidate.Candidate) {
 				s.handleICECandidate(peerConnection, *msg.Candidate)
 			}
 		}
@@ -558,6 +743,8 @@ func (s *TrustDiaryService) handleWebSocketSignaling(w http.ResponseWriter, r *h
 	delete(s.connections, peerID)
 	delete(s.dataChannels, peerID)
 	s.mu.Unlock()
+
+	s.events.Publish(EventPeerDisconnected, map[string]string{"peer": peerID[:8]})
 }
 
 // handleOffer handles WebRTC offer
@@ -617,15 +804,38 @@ func (s *TrustDiaryService) sendAuthChallenge(peerID string, dc *webrtc.DataChan
 	challenge := make([]byte, 32)
 	rand.Read(challenge)
 
+	expires := time.Now().Add(authTimeout)
 	s.mu.Lock()
-	s.connections[peerID].Challenge = challenge
+	conn := s.connections[peerID]
+	if conn == nil {
+		s.mu.Unlock()
+		return
+	}
+	conn.Challenge = challenge
+	conn.ChallengeExpires = expires
 	s.mu.Unlock()
 
+	s.recordAudit(AuditRecord{Action: AuditChallengeIssued, Peer: peerID})
+
+	// Peers that never answer are dropped once the challenge expires
+	time.AfterFunc(authTimeout, func() {
+		s.expireUnauthenticated(peerID)
+	})
+
+	// Readers listing the binding capability sign authResponseBytes(challenge,
+	// binding) after checking the fingerprint against the one in their remote
+	// description; the bare challenge is only accepted with ALLOW_UNBOUND_AUTH
+	binding := s.channelBinding(peerID)
 	msg := map[string]interface{}{
 		"type":             "challenge",
 		"challenge":        base64.StdEncoding.EncodeToString(challenge),
-		"servicePublicKey": base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+		"servicePublicKey": binding.ServicePublicKey,
 		"serviceBoxPublicKey": base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
+		"capabilities":     serviceCapabilities,
+		"binding":          authBindingDomain,
+		"peerId":           binding.PeerID,
+		"fingerprint":      binding.Fingerprint,
+		"expiresAt":        expires.UTC().Format(time.RFC3339),
 	}
 
 	data, _ := json.Marshal(msg)
@@ -642,45 +852,243 @@ func (s *TrustDiaryService) handleDataChannelMessage(peerID string, data []byte)
 
 	msgType, _ := msg["type"].(string)
 
+	// Unwrap messages sealed with the connection's shared box key
+	if msgType == "sealed" {
+		s.mu.RLock()
+		var sharedKey *[32]byte
+		if conn := s.connections[peerID]; conn != nil {
+			sharedKey = conn.SharedKey
+		}
+		s.mu.RUnlock()
+
+		if sharedKey == nil {
+			log.Printf("⚠️ Sealed message from %s without negotiated encryption", peerID[:8])
+			return
+		}
+		plaintext, err := openMessage(sharedKey, msg)
+		if err != nil {
+			log.Printf("Failed to open message from %s: %v", peerID[:8], err)
+			return
+		}
+		s.handleDataChannelMessage(peerID, plaintext)
+		return
+	}
+
+	// The auth response and the service proof request are the only messages
+	// accepted before authentication
 	switch msgType {
 	case "response":
 		s.handleAuthResponse(peerID, msg)
+		return
+	case "hello":
+		s.handleHello(peerID, msg)
+		return
+	}
+
+	user, err := s.authorizePeer(peerID, msgType)
+	if err != nil {
+		log.Printf("🚫 Rejected %q from %s: %v", msgType, peerID[:8], err)
+		s.sendError(peerID, msgType, err)
+		return
+	}
+
+	switch msgType {
 	case "request":
 		s.handleEntryRequest(peerID)
+	case "sync":
+		s.handleSyncRequest(peerID, msg)
+	case "search":
+		s.handlePeerSearch(peerID, msg)
+	case "entry", "comment":
+		s.handlePeerEntry(peerID, user, msgType, msg)
+	case "entry-update", "entry-delete":
+		s.handlePeerRevision(peerID, user, msgType, msg)
 	}
 }
 
+// handlePeerEntry adds an entry or comment written by a trusted peer
+func (s *TrustDiaryService) handlePeerEntry(peerID string, user *TrustedUser, msgType string, msg map[string]interface{}) {
+	content, _ := msg["content"].(string)
+	if content == "" {
+		s.sendError(peerID, msgType, fmt.Errorf("content is required"))
+		return
+	}
+
+	replyTo := 0
+	if msgType == "comment" {
+		id, _ := msg["replyTo"].(float64)
+		replyTo = int(id)
+		if replyTo < 1 {
+			s.sendError(peerID, msgType, fmt.Errorf("replyTo is required"))
+			return
+		}
+	}
+
+	entry, err := s.addEntry(content, user, replyTo)
+	if err != nil {
+		s.sendError(peerID, msgType, err)
+		return
+	}
+	log.Printf("📝 %s added %s #%d via DataChannel", user.Name, msgType, entry.ID)
+}
+
+// sendError reports a rejected message back to the peer
+func (s *TrustDiaryService) sendError(peerID, msgType string, cause error) {
+	s.sendToPeer(peerID, map[string]interface{}{
+		"type":    "error",
+		"request": msgType,
+		"error":   cause.Error(),
+	})
+}
+
 // handleAuthResponse handles authentication response
 func (s *TrustDiaryService) handleAuthResponse(peerID string, msg map[string]interface{}) {
-	s.mu.Lock()
-	conn := s.connections[peerID]
-	s.mu.Unlock()
-
-	if conn == nil || conn.Challenge == nil {
+	// Each challenge is consumed by the first response, valid or not
+	conn, challenge, fresh := s.takeChallenge(peerID)
+	if challenge == nil {
 		log.Printf("⚠️ Unexpected auth response from %s", peerID[:8])
 		return
 	}
+	if !fresh {
+		log.Printf("⏱️ Stale auth response from %s", peerID[:8])
+		s.recordAudit(AuditRecord{Action: AuditChallengeStale, Peer: peerID})
+		s.sendError(peerID, "response", errors.New("challenge expired"))
+		return
+	}
 
-	// Verify signature
+	// Verify the signature over the challenge and this session's binding
 	sigStr, _ := msg["signature"].(string)
 	pubKeyStr, _ := msg["publicKey"].(string)
 
 	signature, _ := base64.StdEncoding.DecodeString(sigStr)
 	pubKey, _ := base64.StdEncoding.DecodeString(pubKeyStr)
 
-	if !ed25519.Verify(ed25519.PublicKey(pubKey), conn.Challenge, signature) {
+	// A signature over the bare challenge can be relayed from another
+	// session, so it is only accepted when ALLOW_UNBOUND_AUTH is set
+	bound := hasCapability(msg, CapabilityBinding)
+	if !bound && !s.allowUnboundAuth {
+		log.Printf("⛔ Unbound auth response from %s", peerID[:8])
+		s.recordAudit(AuditRecord{
+			Action:      AuditUnboundResponse,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+			Detail:      "rejected",
+		})
+		s.events.Publish(EventPeerRejected, map[string]string{
+			"peer":   peerID[:8],
+			"reason": "unbound",
+		})
+		s.sendError(peerID, "response", errors.New("response must be bound to the session; update the reader"))
+		s.setConnState(conn, "untrusted")
+		return
+	}
+	signed := challenge
+	if bound {
+		signed = authResponseBytes(challenge, s.channelBinding(peerID))
+	}
+	if len(pubKey) != ed25519.PublicKeySize || !ed25519.Verify(ed25519.PublicKey(pubKey), signed, signature) {
 		log.Printf("❌ Authentication failed for %s", peerID[:8])
+		s.recordAudit(AuditRecord{
+			Action:      AuditSignatureFailed,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+		})
+		s.events.Publish(EventPeerRejected, map[string]string{
+			"peer":   peerID[:8],
+			"reason": "bad-signature",
+		})
 		return
 	}
+	if !bound {
+		log.Printf("⚠️ %s... signed the bare challenge; accepted because ALLOW_UNBOUND_AUTH is set", peerID[:8])
+		s.recordAudit(AuditRecord{
+			Action:      AuditUnboundResponse,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+			Detail:      "accepted",
+		})
+	}
 
 	// Check if trusted
 	s.mu.RLock()
 	trusted, exists := s.trustedUsers[pubKeyStr]
 	s.mu.RUnlock()
 
+	// A valid invite enrolls the key that just proved possession
+	if inviteToken, _ := msg["invite"].(string); !exists && inviteToken != "" {
+		boxPubKeyStr, _ := msg["boxPublicKey"].(string)
+		// The reader's name is only used when the invite does not set one
+		name, _ := msg["name"].(string)
+
+		user, err := s.redeemInvite(inviteToken, pubKeyStr, boxPubKeyStr, name)
+		if err != nil {
+			log.Printf("⛔ Invite rejected for %s: %v", peerID[:8], err)
+			s.recordAudit(AuditRecord{
+				Action:      AuditUntrustedKey,
+				Peer:        peerID,
+				Fingerprint: keyFingerprint(pubKeyStr),
+				Detail:      "invite: " + err.Error(),
+			})
+			s.events.Publish(EventPeerRejected, map[string]string{
+				"peer":      peerID[:8],
+				"reason":    "invite",
+				"publicKey": pubKeyStr,
+			})
+			s.sendError(peerID, "response", err)
+			s.setConnState(conn, "untrusted")
+			return
+		}
+		log.Printf("✉️ Enrolled %s via invite (%s...)", user.Name, peerID[:8])
+		s.recordAudit(AuditRecord{
+			Action:      AuditInviteRedeemed,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+			Name:        user.Name,
+			Detail:      strings.Join(user.Permissions, ","),
+		})
+		trusted, exists = user, true
+	}
+
 	if !exists {
 		log.Printf("⛔ Untrusted key from %s", peerID[:8])
-		conn.State = "untrusted"
+		s.recordAudit(AuditRecord{
+			Action:      AuditUntrustedKey,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+		})
+		s.events.Publish(EventPeerRejected, map[string]string{
+			"peer":      peerID[:8],
+			"reason":    "untrusted",
+			"publicKey": pubKeyStr,
+		})
+		s.setConnState(conn, "untrusted")
+		return
+	}
+
+	// Enforce the user's access window
+	if err := trusted.checkAccess(time.Now()); err != nil {
+		log.Printf("⛔ %s refused for %s: %v", trusted.Name, peerID[:8], err)
+		s.recordAudit(AuditRecord{
+			Action:      AuditAccessDenied,
+			Peer:        peerID,
+			Fingerprint: keyFingerprint(pubKeyStr),
+			Name:        trusted.Name,
+			Detail:      err.Error(),
+		})
+		s.events.Publish(EventPeerRejected, map[string]string{
+			"peer":      peerID[:8],
+			"reason":    "access",
+			"publicKey": pubKeyStr,
+		})
+		s.sendError(peerID, "response", err)
+		s.setConnState(conn, "lapsed")
+		return
+	}
+
+	// Agree on payload encryption before any entry is sent
+	if err := s.negotiateEncryption(conn, trusted, msg); err != nil {
+		log.Printf("⚠️ Encryption negotiation failed for %s: %v", peerID[:8], err)
+		s.sendError(peerID, "response", err)
 		return
 	}
 
@@ -690,12 +1098,48 @@ func (s *TrustDiaryService) handleAuthResponse(peerID string, msg map[string]int
 	conn.PublicKey = pubKeyStr
 	conn.Name = trusted.Name
 	conn.Authenticated = true
+	encryption := "none"
+	if conn.SharedKey != nil {
+		encryption = CapabilityBox
+	}
 	s.mu.Unlock()
 
-	log.Printf("✅ Authenticated: %s (%s...)", trusted.Name, peerID[:8])
+	log.Printf("✅ Authenticated: %s (%s..., encryption: %s)", trusted.Name, peerID[:8], encryption)
+	s.recordAudit(AuditRecord{
+		Action:      AuditAuthenticated,
+		Peer:        peerID,
+		Fingerprint: keyFingerprint(pubKeyStr),
+		Name:        trusted.Name,
+		Detail:      "encryption: " + encryption,
+	})
+	s.events.Publish(EventPeerAuthenticated, map[string]string{
+		"peer":       peerID[:8],
+		"name":       trusted.Name,
+		"publicKey":  pubKeyStr,
+		"encryption": encryption,
+	})
 
-	// Send entries to authenticated peer
-	s.sendEntriesToPeer(peerID)
+	// Confirmation stays in plaintext so the reader learns the negotiated mode
+	s.mu.RLock()
+	dc := s.dataChannels[peerID]
+	s.mu.RUnlock()
+	if dc != nil {
+		confirmation := map[string]interface{}{
+			"type":       "authenticated",
+			"encryption": encryption,
+		}
+		// Relay credentials for this reader's later connections
+		if servers := s.readerTURNServers(); servers != nil {
+			confirmation["iceServers"] = servers
+		}
+		data, _ := json.Marshal(confirmation)
+		dc.SendText(string(data))
+	}
+
+	// Readers that sync incrementally ask for what they miss themselves
+	if !hasCapability(msg, CapabilitySync) {
+		s.sendEntriesToPeer(peerID)
+	}
 }
 
 // handleEntryRequest handles request for entries
@@ -714,44 +1158,48 @@ func (s *TrustDiaryService) handleEntryRequest(peerID string) {
 // sendEntriesToPeer sends all entries to authenticated peer
 func (s *TrustDiaryService) sendEntriesToPeer(peerID string) {
 	s.mu.RLock()
-	dc := s.dataChannels[peerID]
 	conn := s.connections[peerID]
 	entries := s.entries
 	s.mu.RUnlock()
 
-	if dc == nil || conn == nil || !conn.Authenticated {
+	if conn == nil || !conn.Authenticated {
 		return
 	}
 
 	for _, entry := range entries {
-		msg := map[string]interface{}{
-			"type":  "entry",
+		s.sendToPeer(peerID, map[string]interface{}{
+			"type":  recordMessageType(entry),
 			"entry": entry,
-		}
-
-		data, _ := json.Marshal(msg)
-		dc.SendText(string(data))
+		})
 	}
+
+	s.sendChainHead(peerID)
 }
 
 // broadcastEntry broadcasts entry to all authenticated peers
 func (s *TrustDiaryService) broadcastEntry(entry DiaryEntry) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
 	msg := map[string]interface{}{
-		"type":  "entry",
+		"type":  recordMessageType(entry),
 		"entry": entry,
 	}
-	data, _ := json.Marshal(msg)
 
+	for _, peerID := range s.authenticatedPeers() {
+		s.sendToPeer(peerID, msg)
+	}
+}
+
+// authenticatedPeers returns the IDs of all authenticated connections
+func (s *TrustDiaryService) authenticatedPeers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	peers := make([]string, 0, len(s.connections))
 	for peerID, conn := range s.connections {
 		if conn.Authenticated {
-			if dc, ok := s.dataChannels[peerID]; ok {
-				dc.SendText(string(data))
-			}
+			peers = append(peers, peerID)
 		}
 	}
+	return peers
 }
 
 func main() {
@@ -769,6 +1217,91 @@ func main() {
 	// Create and initialize service
 	service := NewTrustDiaryService(dataDir, port)
 
+	switch mode := os.Getenv("ADMIN_AUTH"); mode {
+	case "", AdminAuthSigned:
+	case AdminAuthLocalhost:
+		service.adminAuthMode = mode
+	default:
+		log.Fatalf("Unknown ADMIN_AUTH mode %q", mode)
+	}
+
+	service.storagePassphrase = os.Getenv("STORAGE_PASSPHRASE")
+	service.storageBackend = os.Getenv("STORAGE_BACKEND")
+
+	if v := os.Getenv("AUDIT_MAX_BYTES"); v != "" {
+		maxBytes, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || maxBytes < 0 {
+			log.Fatalf("AUDIT_MAX_BYTES must be a non-negative integer")
+		}
+		service.auditMaxBytes = maxBytes
+	}
+	if v := os.Getenv("AUDIT_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			log.Fatalf("AUDIT_RETENTION_DAYS must be a non-negative integer")
+		}
+		service.auditRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	switch policy := os.Getenv("CHAIN_BREAK_POLICY"); policy {
+	case "", ChainBreakRefuse:
+	case ChainBreakQuarantine:
+		service.chainBreakPolicy = policy
+	default:
+		log.Fatalf("Unknown CHAIN_BREAK_POLICY %q", policy)
+	}
+
+	service.migrateLegacy = os.Getenv("MIGRATE_LEGACY_ENTRIES") != ""
+
+	// Readers that predate channel binding sign the bare challenge, which a
+	// malicious service could relay to this one
+	if os.Getenv("ALLOW_UNBOUND_AUTH") != "" {
+		service.allowUnboundAuth = true
+		log.Printf("⚠️ ALLOW_UNBOUND_AUTH is set: readers may authenticate without binding their response to the session")
+	}
+
+	iceConfig, err := loadICEConfig()
+	if err != nil {
+		log.Fatalf("Invalid ICE configuration: %v", err)
+	}
+	service.ice = iceConfig
+
+	passphrase, err := passphraseFromEnv("IDENTITY_PASSPHRASE")
+	if err != nil {
+		log.Fatalf("Failed to read identity passphrase: %v", err)
+	}
+	service.identityPassphrase = passphrase
+
+	// "passwd" changes the identity passphrase and re-seals identity.json
+	if len(os.Args) > 1 && os.Args[1] == "passwd" {
+		if err := service.changeIdentityPassphrase(); err != nil {
+			log.Fatalf("Failed to change passphrase: %v", err)
+		}
+		return
+	}
+
+	// "rotate-key [reason]" replaces the identity and retires the old key
+	if len(os.Args) > 1 && os.Args[1] == "rotate-key" {
+		reason := strings.Join(os.Args[2:], " ")
+		if err := service.rotateIdentity(reason); err != nil {
+			log.Fatalf("Failed to rotate identity: %v", err)
+		}
+		return
+	}
+
+	// "token" prints an admin session token signed by the service identity
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := service.loadOrGenerateIdentity(); err != nil {
+			log.Fatalf("Failed to load identity: %v", err)
+		}
+		token, _, err := service.issueSessionToken(base64.StdEncoding.EncodeToString(service.identity.PublicKey))
+		if err != nil {
+			log.Fatalf("Failed to issue token: %v", err)
+		}
+		fmt.Println(token)
+		return
+	}
+
 	if err := service.Initialize(); err != nil {
 		log.Fatalf("Failed to initialize service: %v", err)
 	}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleAddTrustedValidatesKeys(t *testing.T) {
+	reader, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signKey := base64.StdEncoding.EncodeToString(reader.PublicKey)
+	boxKey := base64.StdEncoding.EncodeToString(reader.BoxPublicKey[:])
+	short := base64.StdEncoding.EncodeToString(reader.PublicKey[:16])
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"signing key only", `{"name":"Alice","publicKey":"` + signKey + `"}`, http.StatusOK},
+		{"both keys", `{"name":"Alice","publicKey":"` + signKey + `","boxPublicKey":"` + boxKey + `"}`, http.StatusOK},
+		{"missing key", `{"name":"Alice"}`, http.StatusBadRequest},
+		{"not base64", `{"name":"Alice","publicKey":"not a key!"}`, http.StatusBadRequest},
+		{"short key", `{"name":"Alice","publicKey":"` + short + `"}`, http.StatusBadRequest},
+		{"short box key", `{"name":"Alice","publicKey":"` + signKey + `","boxPublicKey":"` + short + `"}`, http.StatusBadRequest},
+		{"box key not base64", `{"name":"Alice","publicKey":"` + signKey + `","boxPublicKey":"???"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testService(t)
+			s.store = newJSONStore(t.TempDir(), testCipher(t))
+
+			w := httptest.NewRecorder()
+			r := withPrincipal(httptest.NewRequest("POST", "/api/trusted", strings.NewReader(tt.body)), localAdmin)
+			s.handleAddTrusted(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status %d (%s), want %d", w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+			if added := len(s.trustedUsers) > 0; added != (tt.want == http.StatusOK) {
+				t.Fatalf("trusted users after request: %d", len(s.trustedUsers))
+			}
+		})
+	}
+}
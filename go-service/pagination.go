@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// entriesMaxLimit caps the page size of GET /api/entries
+	entriesMaxLimit = 500
+)
+
+// EntryFilter selects a page of entries
+type EntryFilter struct {
+	Limit      int
+	Before     int
+	After      int
+	Author     string
+	From       time.Time
+	To         time.Time
+	Descending bool
+}
+
+// parseEntryFilter reads limit, before, after, author, from, to and order
+func parseEntryFilter(params url.Values) (EntryFilter, error) {
+	var filter EntryFilter
+	var err error
+
+	ints := map[string]*int{
+		"limit":  &filter.Limit,
+		"before": &filter.Before,
+		"after":  &filter.After,
+	}
+	for name, dst := range ints {
+		if v := params.Get(name); v != "" {
+			if *dst, err = strconv.Atoi(v); err != nil || *dst < 0 {
+				return filter, errors.New(name + " must be a non-negative integer")
+			}
+		}
+	}
+	if filter.Limit > entriesMaxLimit {
+		filter.Limit = entriesMaxLimit
+	}
+
+	filter.Author = params.Get("author")
+
+	if v := params.Get("from"); v != "" {
+		if filter.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("from must be an RFC 3339 time")
+		}
+	}
+	if v := params.Get("to"); v != "" {
+		if filter.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, errors.New("to must be an RFC 3339 time")
+		}
+	}
+
+	switch strings.ToLower(params.Get("order")) {
+	case "", "asc":
+	case "desc":
+		filter.Descending = true
+	default:
+		return filter, errors.New("order must be asc or desc")
+	}
+
+	return filter, nil
+}
+
+// matches reports whether an entry passes the non-cursor filters
+func (f EntryFilter) matches(entry DiaryEntry) bool {
+	if f.Author != "" && entry.Author != f.Author {
+		return false
+	}
+	if !f.From.IsZero() && entry.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && entry.Timestamp.After(f.To) {
+		return false
+	}
+	if f.Before > 0 && entry.ID >= f.Before {
+		return false
+	}
+	if f.After > 0 && entry.ID <= f.After {
+		return false
+	}
+	return true
+}
+
+// apply filters and sorts entries and cuts one page; the returned cursor is
+// the ID to pass as before (descending) or after (ascending) for the next
+// page, or 0 when there is none
+func (f EntryFilter) apply(entries []DiaryEntry) ([]DiaryEntry, int) {
+	page := make([]DiaryEntry, 0, len(entries))
+	for _, entry := range entries {
+		if f.matches(entry) {
+			page = append(page, entry)
+		}
+	}
+
+	if f.Descending {
+		sort.SliceStable(page, func(i, j int) bool { return page[i].ID > page[j].ID })
+	}
+
+	if f.Limit == 0 || len(page) <= f.Limit {
+		return page, 0
+	}
+	page = page[:f.Limit]
+	return page, page[len(page)-1].ID
+}
+
+// entriesETag identifies a response by the log head it was built from and
+// the query that shaped it
+func entriesETag(head, rawQuery string) string {
+	sum := sha256.Sum256([]byte(head + "?" + rawQuery))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
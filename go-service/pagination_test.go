@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func entryIDs(entries []DiaryEntry) []int {
+	ids := make([]int, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+func TestEntryFilterApply(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var entries []DiaryEntry
+	for i := 1; i <= 6; i++ {
+		author := "owner"
+		if i%2 == 0 {
+			author = "guest"
+		}
+		entries = append(entries, DiaryEntry{
+			ID:        i,
+			Author:    author,
+			Timestamp: start.Add(time.Duration(i) * 24 * time.Hour),
+		})
+	}
+
+	tests := []struct {
+		name   string
+		filter EntryFilter
+		want   []int
+		cursor int
+	}{
+		{"everything", EntryFilter{}, []int{1, 2, 3, 4, 5, 6}, 0},
+		{"first page", EntryFilter{Limit: 2}, []int{1, 2}, 2},
+		{"next page", EntryFilter{Limit: 2, After: 2}, []int{3, 4}, 4},
+		{"last page", EntryFilter{Limit: 2, After: 4}, []int{5, 6}, 0},
+		{"newest first", EntryFilter{Limit: 4, Descending: true}, []int{6, 5, 4, 3}, 3},
+		{"older page", EntryFilter{Limit: 4, Descending: true, Before: 3}, []int{2, 1}, 0},
+		{"author", EntryFilter{Author: "guest"}, []int{2, 4, 6}, 0},
+		{"author paged", EntryFilter{Author: "guest", Limit: 2}, []int{2, 4}, 4},
+		{"time range", EntryFilter{
+			From: start.Add(2 * 24 * time.Hour),
+			To:   start.Add(4 * 24 * time.Hour),
+		}, []int{2, 3, 4}, 0},
+		{"nothing", EntryFilter{Author: "nobody"}, []int{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, cursor := tt.filter.apply(entries)
+			if got := entryIDs(page); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if cursor != tt.cursor {
+				t.Fatalf("cursor %d, want %d", cursor, tt.cursor)
+			}
+		})
+	}
+
+	// Sorting a page must not reorder the caller's slice
+	if ids := entryIDs(entries); !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5, 6}) {
+		t.Fatalf("input reordered: %v", ids)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Permissions that can be granted to a trusted user
+const (
+	PermRead    = "read"
+	PermWrite   = "write"
+	PermComment = "comment"
+	PermAdmin   = "admin"
+)
+
+// knownPermissions lists every permission the service understands
+var knownPermissions = map[string]bool{
+	PermRead:    true,
+	PermWrite:   true,
+	PermComment: true,
+	PermAdmin:   true,
+}
+
+// messagePermissions maps each DataChannel message type to the permission it requires
+var messagePermissions = map[string]string{
+	"request":      PermRead,
+	"sync":         PermRead,
+	"search":       PermRead,
+	"entry":        PermWrite,
+	"entry-update": PermWrite,
+	"entry-delete": PermWrite,
+	"comment":      PermComment,
+}
+
+var (
+	errNotAuthenticated = errors.New("not authenticated")
+	errNotTrusted       = errors.New("not a trusted user")
+	errForbidden        = errors.New("permission denied")
+)
+
+// principalKey is the request context key holding the acting TrustedUser
+type principalKey struct{}
+
+// localAdmin is the principal for requests signed by the service identity itself
+var localAdmin = &TrustedUser{
+	Name:        "Admin",
+	Permissions: []string{PermAdmin},
+}
+
+// HasPermission reports whether the user holds perm; admin implies every permission
+func (u *TrustedUser) HasPermission(perm string) bool {
+	for _, p := range u.Permissions {
+		if p == perm || p == PermAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePermissions rejects permission names the service does not know
+func validatePermissions(perms []string) error {
+	for _, p := range perms {
+		if !knownPermissions[p] {
+			return fmt.Errorf("unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// authorize is the central check every action goes through
+func (s *TrustDiaryService) authorize(user *TrustedUser, perm string) error {
+	if user == nil {
+		return errNotTrusted
+	}
+	if err := user.checkAccess(time.Now()); err != nil {
+		return err
+	}
+	if !user.HasPermission(perm) {
+		return fmt.Errorf("%w: %s requires %q", errForbidden, user.Name, perm)
+	}
+	return nil
+}
+
+// authorizePeer resolves the trusted user behind a peer and checks it may send msgType
+func (s *TrustDiaryService) authorizePeer(peerID, msgType string) (*TrustedUser, error) {
+	perm, ok := messagePermissions[msgType]
+	if !ok {
+		return nil, fmt.Errorf("unknown message type %q", msgType)
+	}
+
+	s.mu.RLock()
+	conn := s.connections[peerID]
+	var user *TrustedUser
+	if conn != nil && conn.Authenticated {
+		user = s.trustedUsers[conn.PublicKey]
+	}
+	s.mu.RUnlock()
+
+	if conn == nil || !conn.Authenticated {
+		return nil, errNotAuthenticated
+	}
+
+	if err := s.authorize(user, perm); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// principalFromRequest returns the user acting on behalf of an HTTP request
+func principalFromRequest(r *http.Request) *TrustedUser {
+	user, _ := r.Context().Value(principalKey{}).(*TrustedUser)
+	return user
+}
+
+// withPrincipal attaches the acting user to the request context
+func withPrincipal(r *http.Request, user *TrustedUser) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, user))
+}
+
+// requirePermission wraps an HTTP handler with the same authorizer used for peers
+func (s *TrustDiaryService) requirePermission(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := principalFromRequest(r)
+		if user == nil {
+			http.Error(w, errNotAuthenticated.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if err := s.authorize(user, perm); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
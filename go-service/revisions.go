@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Kinds of log record besides plain entries
+const (
+	KindEdit   = "edit"
+	KindDelete = "delete"
+)
+
+var (
+	errEntryNotFound   = errors.New("entry not found")
+	errContentRequired = errors.New("content is required")
+)
+
+// recordMessageType returns the DataChannel message type announcing a log record
+func recordMessageType(record DiaryEntry) string {
+	switch record.Kind {
+	case KindEdit:
+		return "entry-update"
+	case KindDelete:
+		return "entry-delete"
+	}
+	return "entry"
+}
+
+// appendRecord assigns the next ID, links the record into the chain, persists
+// it and pushes it to peers. validate and the write both run under the lock,
+// so the log on disk always matches memory
+func (s *TrustDiaryService) appendRecord(record DiaryEntry, validate func() error) (DiaryEntry, error) {
+	s.mu.Lock()
+	if validate != nil {
+		if err := validate(); err != nil {
+			s.mu.Unlock()
+			return DiaryEntry{}, err
+		}
+	}
+	record.ID = len(s.entries) + 1
+	record.Timestamp = time.Now()
+	s.linkEntry(&record, s.lastHash())
+	if err := s.store.AppendEntry(record); err != nil {
+		s.mu.Unlock()
+		return DiaryEntry{}, err
+	}
+	s.entries = append(s.entries, record)
+	s.indexRecord(record)
+	s.mu.Unlock()
+
+	// Broadcast to connected peers and dashboards
+	s.broadcastEntry(record)
+	s.events.Publish(recordEventType(record), record)
+
+	detail := fmt.Sprintf("entry %d", record.ID)
+	if record.Kind != "" {
+		detail = fmt.Sprintf("entry %d (%s of %d)", record.ID, record.Kind, record.Target)
+	}
+	s.recordAudit(AuditRecord{
+		Action: recordEventType(record),
+		Name:   record.Author,
+		Detail: detail,
+	})
+
+	return record, nil
+}
+
+// liveEntry returns the original record of an entry that has not been
+// deleted; the caller holds s.mu
+func (s *TrustDiaryService) liveEntry(id int) (*DiaryEntry, error) {
+	var found *DiaryEntry
+	for i := range s.entries {
+		record := &s.entries[i]
+		switch {
+		case record.ID == id && record.Kind == "":
+			found = record
+		case record.Kind == KindDelete && record.Target == id:
+			return nil, errEntryNotFound
+		}
+	}
+	if found == nil {
+		return nil, errEntryNotFound
+	}
+	return found, nil
+}
+
+// canModify checks the user may change an entry: its author or an admin.
+// Authors are matched by key, since names can be reused; entries that predate
+// AuthorKey can only be changed by an admin
+func canModify(user *TrustedUser, entry *DiaryEntry) error {
+	if user.HasPermission(PermAdmin) {
+		return nil
+	}
+	if entry.AuthorKey != "" && entry.AuthorKey == user.PublicKey {
+		return nil
+	}
+	return fmt.Errorf("%w: only the author or an admin may change entry %d", errForbidden, entry.ID)
+}
+
+// editEntry appends a revision replacing an entry's content
+func (s *TrustDiaryService) editEntry(id int, content string, user *TrustedUser) (DiaryEntry, error) {
+	if content == "" {
+		return DiaryEntry{}, errContentRequired
+	}
+	return s.appendRecord(DiaryEntry{
+		Kind:      KindEdit,
+		Target:    id,
+		Content:   content,
+		Author:    user.Name,
+		AuthorKey: user.PublicKey,
+	}, func() error {
+		entry, err := s.liveEntry(id)
+		if err != nil {
+			return err
+		}
+		return canModify(user, entry)
+	})
+}
+
+// deleteEntry appends a tombstone for an entry
+func (s *TrustDiaryService) deleteEntry(id int, user *TrustedUser) (DiaryEntry, error) {
+	return s.appendRecord(DiaryEntry{
+		Kind:      KindDelete,
+		Target:    id,
+		Author:    user.Name,
+		AuthorKey: user.PublicKey,
+	}, func() error {
+		entry, err := s.liveEntry(id)
+		if err != nil {
+			return err
+		}
+		return canModify(user, entry)
+	})
+}
+
+// currentEntries folds the log into the latest revision of every live entry.
+// Revised entries carry the revision number and drop the original signature,
+// which no longer covers their content; the log records remain verifiable
+func (s *TrustDiaryService) currentEntries() []DiaryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := make(map[int]int)
+	current := make([]DiaryEntry, 0, len(s.entries))
+	deleted := make(map[int]bool)
+
+	for _, record := range s.entries {
+		switch record.Kind {
+		case "":
+			index[record.ID] = len(current)
+			current = append(current, record)
+		case KindEdit:
+			if i, ok := index[record.Target]; ok {
+				entry := &current[i]
+				entry.Content = record.Content
+				entry.Revision++
+				editedAt := record.Timestamp
+				entry.EditedAt = &editedAt
+				entry.Signature, entry.SignedBy, entry.PrevHash, entry.Hash = "", "", "", ""
+			}
+		case KindDelete:
+			deleted[record.Target] = true
+		}
+	}
+
+	live := current[:0]
+	for _, entry := range current {
+		if !deleted[entry.ID] {
+			live = append(live, entry)
+		}
+	}
+	return live
+}
+
+// entryRevisions returns the original record of an entry followed by its
+// edits and tombstone
+func (s *TrustDiaryService) entryRevisions(id int) []DiaryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := []DiaryEntry{}
+	for _, record := range s.entries {
+		if (record.ID == id && record.Kind == "") || (record.Kind != "" && record.Target == id) {
+			revisions = append(revisions, record)
+		}
+	}
+	return revisions
+}
+
+// entryIDFromRequest parses the {id} route variable
+func entryIDFromRequest(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+// writeEntryError maps entry errors to HTTP status codes
+func writeEntryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errEntryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errForbidden):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// handleUpdateEntry stores a new revision of an entry
+func (s *TrustDiaryService) handleUpdateEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := entryIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "invalid entry id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	record, err := s.editEntry(id, req.Content, principalFromRequest(r))
+	if err != nil {
+		writeEntryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handleDeleteEntry tombstones an entry
+func (s *TrustDiaryService) handleDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := entryIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "invalid entry id", http.StatusBadRequest)
+		return
+	}
+
+	record, err := s.deleteEntry(id, principalFromRequest(r))
+	if err != nil {
+		writeEntryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handleGetRevisions returns the revision history of an entry
+func (s *TrustDiaryService) handleGetRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := entryIDFromRequest(r)
+	if err != nil {
+		http.Error(w, "invalid entry id", http.StatusBadRequest)
+		return
+	}
+
+	revisions := s.entryRevisions(id)
+	if len(revisions) == 0 {
+		http.Error(w, errEntryNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// handlePeerRevision applies an entry-update or entry-delete sent by a peer
+func (s *TrustDiaryService) handlePeerRevision(peerID string, user *TrustedUser, msgType string, msg map[string]interface{}) {
+	idFloat, _ := msg["id"].(float64)
+	id := int(idFloat)
+
+	var record DiaryEntry
+	var err error
+	if msgType == "entry-update" {
+		content, _ := msg["content"].(string)
+		record, err = s.editEntry(id, content, user)
+	} else {
+		record, err = s.deleteEntry(id, user)
+	}
+
+	if err != nil {
+		s.sendError(peerID, msgType, err)
+		return
+	}
+	log.Printf("✏️ %s applied %s to #%d via DataChannel (record #%d)", user.Name, record.Kind, id, record.ID)
+}
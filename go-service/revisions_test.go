@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCanModify(t *testing.T) {
+	alice := &TrustedUser{PublicKey: "alice-key", Name: "Alice", Permissions: []string{PermWrite}}
+	impostor := &TrustedUser{PublicKey: "other-key", Name: "Alice", Permissions: []string{PermWrite}}
+	admin := &TrustedUser{PublicKey: "admin-key", Name: "Root", Permissions: []string{PermAdmin}}
+
+	tests := []struct {
+		name  string
+		user  *TrustedUser
+		entry DiaryEntry
+		ok    bool
+	}{
+		{"author", alice, DiaryEntry{ID: 1, Author: "Alice", AuthorKey: "alice-key"}, true},
+		{"same name, other key", impostor, DiaryEntry{ID: 1, Author: "Alice", AuthorKey: "alice-key"}, false},
+		{"admin", admin, DiaryEntry{ID: 1, Author: "Alice", AuthorKey: "alice-key"}, true},
+		{"entry without key", alice, DiaryEntry{ID: 1, Author: "Alice"}, false},
+		{"entry without key, admin", admin, DiaryEntry{ID: 1, Author: "Alice"}, true},
+		{"keyless user", &TrustedUser{Name: "Alice", Permissions: []string{PermWrite}}, DiaryEntry{ID: 1, Author: "Alice"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := canModify(tt.user, &tt.entry)
+			if (err == nil) != tt.ok {
+				t.Fatalf("canModify = %v, want ok=%v", err, tt.ok)
+			}
+			if err != nil && !errors.Is(err, errForbidden) {
+				t.Fatalf("error %v is not errForbidden", err)
+			}
+		})
+	}
+}
+
+func TestEditRequiresContent(t *testing.T) {
+	s := testService(t)
+	s.store = newJSONStore(t.TempDir(), testCipher(t))
+	alice := &TrustedUser{PublicKey: "alice-key", Name: "Alice", Permissions: []string{PermWrite}}
+	entry, err := s.addEntry("first", alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.AuthorKey != alice.PublicKey || !VerifyEntry(entry) {
+		t.Fatalf("entry %+v does not carry a signed author key", entry)
+	}
+
+	if _, err := s.editEntry(entry.ID, "", alice); !errors.Is(err, errContentRequired) {
+		t.Fatalf("editEntry with no content: %v", err)
+	}
+
+	req := httptest.NewRequest("PUT", "/api/entries/1", strings.NewReader(`{"content":""}`))
+	req = withPrincipal(mux.SetURLVars(req, map[string]string{"id": "1"}), alice)
+	w := httptest.NewRecorder()
+	s.handleUpdateEntry(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("empty update over HTTP: status %d", w.Code)
+	}
+	if len(s.entries) != 1 {
+		t.Fatalf("rejected edits were appended: %d records", len(s.entries))
+	}
+}
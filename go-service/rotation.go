@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rolloverDomain separates rollover signatures from other uses of the keys
+const rolloverDomain = "trust-diary-rollover-v1"
+
+// RolloverStatement announces that the service moved from one identity to
+// the next, including the room IDs derived from each
+type RolloverStatement struct {
+	OldPublicKey    string    `json:"oldPublicKey"`
+	NewPublicKey    string    `json:"newPublicKey"`
+	NewBoxPublicKey string    `json:"newBoxPublicKey"`
+	OldRoomID       string    `json:"oldRoomId"`
+	NewRoomID       string    `json:"newRoomId"`
+	RotatedAt       time.Time `json:"rotatedAt"`
+	Reason          string    `json:"reason,omitempty"`
+}
+
+// Rollover is a statement signed by the outgoing key, which vouches for the
+// successor, and by the incoming key, which proves it is held
+type Rollover struct {
+	Statement    RolloverStatement `json:"statement"`
+	OldSignature string            `json:"oldSignature"`
+	NewSignature string            `json:"newSignature"`
+}
+
+// RetiredKey is a former service identity; entries it signed before
+// RetiredAt still verify
+type RetiredKey struct {
+	PublicKey    string    `json:"publicKey"`
+	BoxPublicKey string    `json:"boxPublicKey"`
+	CreatedAt    time.Time `json:"createdAt"`
+	RetiredAt    time.Time `json:"retiredAt"`
+}
+
+// keyHistory is the layout of keys.json; it holds only public material, so
+// it is stored in the clear like the public half of identity.json
+type keyHistory struct {
+	Retired   []RetiredKey `json:"retired"`
+	Rollovers []Rollover   `json:"rollovers"`
+}
+
+// rolloverBytes is what both keys sign: the domain followed by the statement
+func rolloverBytes(statement RolloverStatement) []byte {
+	data, _ := json.Marshal([]interface{}{
+		rolloverDomain,
+		statement.OldPublicKey,
+		statement.NewPublicKey,
+		statement.NewBoxPublicKey,
+		statement.OldRoomID,
+		statement.NewRoomID,
+		statement.RotatedAt.UTC().Format(time.RFC3339Nano),
+		statement.Reason,
+	})
+	return data
+}
+
+// VerifyRollover checks both signatures on a rollover
+func VerifyRollover(r Rollover) bool {
+	msg := rolloverBytes(r.Statement)
+	for _, pair := range [][2]string{
+		{r.Statement.OldPublicKey, r.OldSignature},
+		{r.Statement.NewPublicKey, r.NewSignature},
+	} {
+		pubKey, err := base64.StdEncoding.DecodeString(pair[0])
+		if err != nil || len(pubKey) != ed25519.PublicKeySize {
+			return false
+		}
+		sig, err := base64.StdEncoding.DecodeString(pair[1])
+		if err != nil || !ed25519.Verify(ed25519.PublicKey(pubKey), msg, sig) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *TrustDiaryService) keysPath() string {
+	return filepath.Join(s.dataDir, "keys.json")
+}
+
+// loadKeyHistory reads retired keys and rollovers, if any
+func (s *TrustDiaryService) loadKeyHistory() error {
+	data, err := os.ReadFile(s.keysPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read key history: %w", err)
+	}
+
+	var history keyHistory
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse key history: %w", err)
+	}
+	for i, r := range history.Rollovers {
+		if !VerifyRollover(r) {
+			return fmt.Errorf("rollover %d in key history has a bad signature", i+1)
+		}
+	}
+
+	s.keys = history
+	return nil
+}
+
+// saveKeyHistory writes keys.json atomically
+func (s *TrustDiaryService) saveKeyHistory() error {
+	data, err := json.MarshalIndent(s.keys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal key history: %w", err)
+	}
+	if err := writeFileAtomic(s.keysPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save key history: %w", err)
+	}
+	return nil
+}
+
+// isRetiredKey reports whether keyStr is a former service key that was
+// still current at the given time
+func (s *TrustDiaryService) isRetiredKey(keyStr string, at time.Time) bool {
+	for _, key := range s.keys.Retired {
+		if key.PublicKey == keyStr && !at.After(key.RetiredAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// previousRoomIDs lists the room IDs of retired identities, oldest first,
+// so discovery can keep answering readers that have not migrated yet
+func (s *TrustDiaryService) previousRoomIDs() []string {
+	ids := make([]string, 0, len(s.keys.Rollovers))
+	for _, r := range s.keys.Rollovers {
+		ids = append(ids, r.Statement.OldRoomID)
+	}
+	return ids
+}
+
+// rotateIdentity replaces the service identity with a fresh one, signs a
+// rollover with both keys and retires the old key. Data sealed with a key
+// derived from the old identity is re-sealed under the new one. Session
+// tokens and invites signed by the old key stop working. It takes the data
+// directory lock, so it refuses to run while the service is up
+func (s *TrustDiaryService) rotateIdentity(reason string) error {
+	lock, err := lockDataDir(s.dataDir)
+	if err != nil {
+		if errors.Is(err, errDataDirLocked) {
+			return fmt.Errorf("%w; stop the service before rotating its key", err)
+		}
+		return err
+	}
+	defer lock.Release()
+
+	if err := s.loadOrGenerateIdentity(); err != nil {
+		return err
+	}
+	if err := s.loadKeyHistory(); err != nil {
+		return err
+	}
+	if err := s.initStorageCipher(); err != nil {
+		return err
+	}
+
+	store, err := s.openStore()
+	if err != nil {
+		return fmt.Errorf("failed to open storage: %w", err)
+	}
+	defer store.Close()
+
+	audit, err := openAuditLog(s.dataDir, s.cipher, s.auditMaxBytes, s.auditRetention)
+	if err != nil {
+		return err
+	}
+	defer audit.Close()
+	s.audit = audit
+
+	// Read everything while the old key can still open it
+	entries, err := store.LoadEntries()
+	if err != nil {
+		return err
+	}
+	trusted, err := store.LoadTrustedUsers()
+	if err != nil {
+		return err
+	}
+	invites, err := store.LoadInvites()
+	if err != nil {
+		return err
+	}
+
+	old := s.identity
+	oldRoomID := s.generateRoomID()
+	oldCipher := s.cipher
+
+	next, err := generateIdentity()
+	if err != nil {
+		return err
+	}
+	s.identity = next
+
+	statement := RolloverStatement{
+		OldPublicKey:    base64.StdEncoding.EncodeToString(old.PublicKey),
+		NewPublicKey:    base64.StdEncoding.EncodeToString(next.PublicKey),
+		NewBoxPublicKey: base64.StdEncoding.EncodeToString(next.BoxPublicKey[:]),
+		OldRoomID:       oldRoomID,
+		NewRoomID:       s.generateRoomID(),
+		RotatedAt:       time.Now().UTC(),
+		Reason:          reason,
+	}
+	msg := rolloverBytes(statement)
+	rollover := Rollover{
+		Statement:    statement,
+		OldSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(old.PrivateKey, msg)),
+		NewSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(next.PrivateKey, msg)),
+	}
+
+	// Keep the old identity file until the data is re-sealed, so a crash
+	// half way through can be recovered by restoring it
+	identityPath := filepath.Join(s.dataDir, "identity.json")
+	backupPath := fmt.Sprintf("%s.rotating-%d", identityPath, time.Now().Unix())
+	if err := os.Rename(identityPath, backupPath); err != nil {
+		return fmt.Errorf("failed to back up identity: %w", err)
+	}
+
+	if err := s.saveIdentity(); err != nil {
+		os.Rename(backupPath, identityPath)
+		return err
+	}
+
+	if oldCipher.kdf == kdfIdentity {
+		if err := s.initStorageCipher(); err != nil {
+			return err
+		}
+		if err := s.resealData(store, audit, oldCipher, entries, trusted, invites); err != nil {
+			return fmt.Errorf("failed to re-seal data (old identity kept at %s): %w", backupPath, err)
+		}
+	}
+
+	s.keys.Retired = append(s.keys.Retired, RetiredKey{
+		PublicKey:    statement.OldPublicKey,
+		BoxPublicKey: base64.StdEncoding.EncodeToString(old.BoxPublicKey[:]),
+		CreatedAt:    old.CreatedAt,
+		RetiredAt:    statement.RotatedAt,
+	})
+	s.keys.Rollovers = append(s.keys.Rollovers, rollover)
+	if err := s.saveKeyHistory(); err != nil {
+		return fmt.Errorf("%w (old identity kept at %s)", err, backupPath)
+	}
+
+	if err := os.Remove(backupPath); err != nil {
+		log.Printf("Warning: failed to remove %s: %v", backupPath, err)
+	}
+
+	s.recordAudit(AuditRecord{
+		Action:      AuditKeyRotated,
+		Fingerprint: keyFingerprint(statement.NewPublicKey),
+		Detail:      fmt.Sprintf("retired %s: %s", keyFingerprint(statement.OldPublicKey), reason),
+	})
+
+	log.Printf("🔁 Rotated service identity")
+	log.Printf("🔑 New Public Key: %s...", statement.NewPublicKey[:32])
+	log.Printf("🌐 P2P Room ID: %s (was %s)", statement.NewRoomID, statement.OldRoomID)
+	return nil
+}
+
+// resealData rewrites the store, the audit log and any quarantine files
+// under the current storage cipher
+func (s *TrustDiaryService) resealData(store Store, audit *auditLog, oldCipher *storageCipher, entries []DiaryEntry, trusted []TrustedUser, invites []Invite) error {
+	rekeyable, ok := store.(interface{ setCipher(*storageCipher) })
+	if !ok {
+		return errors.New("storage backend cannot be re-sealed")
+	}
+	rekeyable.setCipher(s.cipher)
+
+	if err := store.ReplaceEntries(entries); err != nil {
+		return err
+	}
+	if err := store.SaveTrustedUsers(trusted); err != nil {
+		return err
+	}
+	if err := store.SaveInvites(invites); err != nil {
+		return err
+	}
+	if err := audit.reseal(s.cipher); err != nil {
+		return err
+	}
+
+	quarantined, _ := filepath.Glob(filepath.Join(s.dataDir, "entries.quarantine-*.json"))
+	for _, path := range quarantined {
+		var records []DiaryEntry
+		if err := oldCipher.readFile(path, &records); err != nil {
+			return err
+		}
+		if err := s.cipher.writeFile(path, records); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("🔒 Re-sealed %d entries, %d trusted users and %d invites under the new identity",
+		len(entries), len(trusted), len(invites))
+	return nil
+}
+
+// handleGetKeys lists the current key, retired keys and the rollover chain
+func (s *TrustDiaryService) handleGetKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"publicKey":       base64.StdEncoding.EncodeToString(s.identity.PublicKey),
+		"boxPublicKey":    base64.StdEncoding.EncodeToString(s.identity.BoxPublicKey[:]),
+		"roomId":          s.roomID,
+		"previousRoomIds": s.previousRoomIDs(),
+		"retired":         s.keys.Retired,
+		"rollovers":       s.keys.Rollovers,
+	})
+}
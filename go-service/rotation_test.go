@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// signedRollover returns a rollover from one fresh key to another
+func signedRollover(t *testing.T) (Rollover, *Identity, *Identity) {
+	t.Helper()
+	oldID, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newID, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statement := RolloverStatement{
+		OldPublicKey:    base64.StdEncoding.EncodeToString(oldID.PublicKey),
+		NewPublicKey:    base64.StdEncoding.EncodeToString(newID.PublicKey),
+		NewBoxPublicKey: base64.StdEncoding.EncodeToString(newID.BoxPublicKey[:]),
+		OldRoomID:       "old-room",
+		NewRoomID:       "new-room",
+		RotatedAt:       time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Reason:          "scheduled",
+	}
+	msg := rolloverBytes(statement)
+	return Rollover{
+		Statement:    statement,
+		OldSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(oldID.PrivateKey, msg)),
+		NewSignature: base64.StdEncoding.EncodeToString(ed25519.Sign(newID.PrivateKey, msg)),
+	}, oldID, newID
+}
+
+func TestVerifyRollover(t *testing.T) {
+	r, oldID, _ := signedRollover(t)
+	if !VerifyRollover(r) {
+		t.Fatal("valid rollover rejected")
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*Rollover)
+	}{
+		{"changed successor", func(r *Rollover) {
+			other, _ := generateIdentity()
+			r.Statement.NewPublicKey = base64.StdEncoding.EncodeToString(other.PublicKey)
+		}},
+		{"changed reason", func(r *Rollover) { r.Statement.Reason = "compromise" }},
+		{"changed time", func(r *Rollover) { r.Statement.RotatedAt = r.Statement.RotatedAt.Add(time.Second) }},
+		{"signatures swapped", func(r *Rollover) { r.OldSignature, r.NewSignature = r.NewSignature, r.OldSignature }},
+		{"missing new signature", func(r *Rollover) { r.NewSignature = "" }},
+		{"new key signed by old key only", func(r *Rollover) {
+			r.NewSignature = base64.StdEncoding.EncodeToString(ed25519.Sign(oldID.PrivateKey, rolloverBytes(r.Statement)))
+		}},
+		{"malformed key", func(r *Rollover) { r.Statement.OldPublicKey = "not base64" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, _ := signedRollover(t)
+			tt.tamper(&r)
+			if VerifyRollover(r) {
+				t.Fatal("tampered rollover accepted")
+			}
+		})
+	}
+}
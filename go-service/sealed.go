@@ -0,0 +1,259 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Key derivation schemes for data at rest
+const (
+	kdfIdentity = "identity"
+	kdfScrypt   = "scrypt"
+)
+
+// sealedFileVersion is the current on-disk envelope format
+const sealedFileVersion = 1
+
+// scrypt parameters for passphrase-derived keys
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// SealedFile is the on-disk envelope for encrypted data files
+type SealedFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// storageCipher seals data files with a key derived from the identity or a passphrase
+type storageCipher struct {
+	kdf        string
+	passphrase []byte
+	salt       []byte
+	key        [32]byte
+
+	mu      sync.Mutex
+	derived map[string]*[32]byte
+}
+
+// newIdentityCipher derives the storage key from the service's box private key
+func newIdentityCipher(identity *Identity) (*storageCipher, error) {
+	c := &storageCipher{kdf: kdfIdentity}
+	r := hkdf.New(sha256.New, identity.BoxPrivateKey[:], nil, []byte("trust-diary-storage-v1"))
+	if _, err := io.ReadFull(r, c.key[:]); err != nil {
+		return nil, fmt.Errorf("failed to derive storage key: %w", err)
+	}
+	return c, nil
+}
+
+// newPassphraseCipher derives storage keys from a passphrase with scrypt
+func newPassphraseCipher(passphrase string) (*storageCipher, error) {
+	c := &storageCipher{
+		kdf:        kdfScrypt,
+		passphrase: []byte(passphrase),
+		salt:       make([]byte, 16),
+		derived:    make(map[string]*[32]byte),
+	}
+	if _, err := rand.Read(c.salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := c.keyForSalt(c.salt)
+	if err != nil {
+		return nil, err
+	}
+	c.key = *key
+	return c, nil
+}
+
+// deriveKey stretches a passphrase into a 32-byte secretbox key
+func deriveKey(passphrase, salt []byte) (*[32]byte, error) {
+	raw, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	var key [32]byte
+	copy(key[:], raw)
+	return &key, nil
+}
+
+// keyForSalt returns the passphrase key for a salt, caching the scrypt result
+func (c *storageCipher) keyForSalt(salt []byte) (*[32]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.derived[string(salt)]; ok {
+		return key, nil
+	}
+	key, err := deriveKey(c.passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	c.derived[string(salt)] = key
+	return key, nil
+}
+
+// seal encrypts plaintext into an envelope
+func (c *storageCipher) seal(plaintext []byte) (*SealedFile, error) {
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return &SealedFile{
+		Version:    sealedFileVersion,
+		KDF:        c.kdf,
+		Salt:       c.salt,
+		Nonce:      nonce[:],
+		Ciphertext: secretbox.Seal(nil, plaintext, &nonce, &c.key),
+	}, nil
+}
+
+// open decrypts an envelope written by seal
+func (c *storageCipher) open(sealed *SealedFile) ([]byte, error) {
+	if sealed.KDF != c.kdf {
+		return nil, fmt.Errorf("file sealed with %q but service uses %q", sealed.KDF, c.kdf)
+	}
+	if len(sealed.Nonce) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+
+	key := &c.key
+	if c.kdf == kdfScrypt {
+		var err error
+		if key, err = c.keyForSalt(sealed.Salt); err != nil {
+			return nil, err
+		}
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed.Nonce)
+	plaintext, ok := secretbox.Open(nil, sealed.Ciphertext, &nonce, key)
+	if !ok {
+		return nil, errors.New("decryption failed (wrong key or corrupted file)")
+	}
+	return plaintext, nil
+}
+
+// sealJSON marshals v and returns the encrypted envelope as JSON
+func (c *storageCipher) sealJSON(v interface{}) ([]byte, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal: %w", err)
+	}
+
+	sealed, err := c.seal(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(sealed, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+	return data, nil
+}
+
+// openJSON decrypts an envelope produced by sealJSON into v
+func (c *storageCipher) openJSON(data []byte, v interface{}) error {
+	var sealed SealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return fmt.Errorf("failed to parse envelope: %w", err)
+	}
+	plaintext, err := c.open(&sealed)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, v)
+}
+
+// writeFile marshals v and atomically writes it encrypted to path
+func (c *storageCipher) writeFile(path string, v interface{}) error {
+	data, err := c.sealJSON(v)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// readFile reads path into v, rewriting legacy plaintext files encrypted
+func (c *storageCipher) readFile(path string, v interface{}) error {
+	plaintext, err := c.decodeFile(path, v)
+	if err != nil || !plaintext {
+		return err
+	}
+
+	// Legacy plaintext file: migrate it in place
+	if err := c.writeFile(path, v); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", path, err)
+	}
+	log.Printf("🔒 Migrated %s to encrypted storage", path)
+	return nil
+}
+
+// decodeFile parses a sealed or legacy plaintext file into v without
+// changing it, and reports whether it was plaintext
+func (c *storageCipher) decodeFile(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	var sealed SealedFile
+	if err := json.Unmarshal(data, &sealed); err == nil && sealed.Version > 0 && sealed.Ciphertext != nil {
+		plaintext, err := c.open(&sealed)
+		if err != nil {
+			return false, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		return false, json.Unmarshal(plaintext, v)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash leaves either the old or the new contents
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
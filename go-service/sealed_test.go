@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testCipher(t *testing.T) *storageCipher {
+	t.Helper()
+	identity, err := generateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := newIdentityCipher(identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestReadFileMigratesPlaintext(t *testing.T) {
+	c := testCipher(t)
+	path := filepath.Join(t.TempDir(), "trusted.json")
+
+	want := []TrustedUser{{PublicKey: "pk", Name: "Alice", Permissions: []string{PermRead}}}
+	plain, _ := json.Marshal(want)
+	if err := os.WriteFile(path, plain, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []TrustedUser
+	if err := c.readFile(path, &got); err != nil {
+		t.Fatalf("readFile: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	// The file is now sealed and still reads back the same
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sealed SealedFile
+	if err := json.Unmarshal(data, &sealed); err != nil || sealed.Version == 0 || sealed.Ciphertext == nil {
+		t.Fatalf("file was not sealed: %s", data)
+	}
+	var again []TrustedUser
+	plaintext, err := c.decodeFile(path, &again)
+	if err != nil || plaintext {
+		t.Fatalf("decodeFile after migration: plaintext=%v err=%v", plaintext, err)
+	}
+	if !reflect.DeepEqual(again, want) {
+		t.Fatalf("after migration got %+v, want %+v", again, want)
+	}
+}
+
+func TestReadFileRejectsOtherKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entries.json")
+	if err := testCipher(t).writeFile(path, []DiaryEntry{{ID: 1, Content: "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	var entries []DiaryEntry
+	if err := testCipher(t).readFile(path, &entries); err == nil {
+		t.Fatal("file sealed with another key was opened")
+	}
+
+	// A file that fails to open must never be rewritten
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Fatal("unreadable sealed file was modified")
+	}
+}
+
+func TestDecodeFileLeavesPlaintextAlone(t *testing.T) {
+	c := testCipher(t)
+	path := filepath.Join(t.TempDir(), "entries.json")
+	plain := []byte(`[{"id":1,"content":"hello","timestamp":"2024-01-01T00:00:00Z","author":"owner"}]`)
+	if err := os.WriteFile(path, plain, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []DiaryEntry
+	plaintext, err := c.decodeFile(path, &entries)
+	if err != nil || !plaintext || len(entries) != 1 {
+		t.Fatalf("decodeFile: plaintext=%v err=%v entries=%d", plaintext, err, len(entries))
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(plain) {
+		t.Fatal("decodeFile rewrote the file")
+	}
+}
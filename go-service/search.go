@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// searchDefaultLimit is the page size when the caller gives none
+	searchDefaultLimit = 20
+	// searchMaxLimit caps the page size
+	searchMaxLimit = 100
+)
+
+// SearchQuery is a parsed search request
+type SearchQuery struct {
+	Terms    []string
+	Prefixes []string
+	Phrases  [][]string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// SearchResult is one page of matching entries
+type SearchResult struct {
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+	Entries []DiaryEntry `json:"entries"`
+}
+
+// indexedDoc is what the index remembers about an entry
+type indexedDoc struct {
+	timestamp time.Time
+	terms     []string
+}
+
+// searchIndex is an inverted index from terms to entry IDs and term positions
+type searchIndex struct {
+	mu       sync.RWMutex
+	postings map[string]map[int][]int
+	docs     map[int]indexedDoc
+}
+
+// newSearchIndex creates an empty index
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[int][]int),
+		docs:     make(map[int]indexedDoc),
+	}
+}
+
+// tokenize lowercases text and splits it into letter and digit runs
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// put indexes or reindexes an entry's text
+func (idx *searchIndex) put(id int, text string, timestamp time.Time) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+
+	terms := tokenize(text)
+	for pos, term := range terms {
+		docs := idx.postings[term]
+		if docs == nil {
+			docs = make(map[int][]int)
+			idx.postings[term] = docs
+		}
+		docs[id] = append(docs[id], pos)
+	}
+	idx.docs[id] = indexedDoc{timestamp: timestamp, terms: terms}
+}
+
+// remove drops an entry from the index
+func (idx *searchIndex) remove(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(id)
+}
+
+func (idx *searchIndex) removeLocked(id int) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range doc.terms {
+		if docs := idx.postings[term]; docs != nil {
+			delete(docs, id)
+			if len(docs) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+	delete(idx.docs, id)
+}
+
+// timestampOf returns the indexed timestamp of an entry
+func (idx *searchIndex) timestampOf(id int) (time.Time, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.docs[id]
+	return doc.timestamp, ok
+}
+
+// search returns the IDs of all entries matching every clause, newest first
+// (IDs are log positions, so a higher ID is a newer entry)
+func (idx *searchIndex) search(q SearchQuery) []int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var candidates map[int]bool
+	narrow := func(ids map[int]bool) {
+		if candidates == nil {
+			candidates = ids
+			return
+		}
+		for id := range candidates {
+			if !ids[id] {
+				delete(candidates, id)
+			}
+		}
+	}
+
+	for _, term := range q.Terms {
+		narrow(idx.docsWithTerm(term))
+	}
+	for _, prefix := range q.Prefixes {
+		ids := make(map[int]bool)
+		for term, docs := range idx.postings {
+			if strings.HasPrefix(term, prefix) {
+				for id := range docs {
+					ids[id] = true
+				}
+			}
+		}
+		narrow(ids)
+	}
+	for _, phrase := range q.Phrases {
+		narrow(idx.docsWithPhrase(phrase))
+	}
+
+	// A query with only a date range matches every entry
+	if candidates == nil {
+		candidates = make(map[int]bool, len(idx.docs))
+		for id := range idx.docs {
+			candidates[id] = true
+		}
+	}
+
+	ids := make([]int, 0, len(candidates))
+	for id := range candidates {
+		ts := idx.docs[id].timestamp
+		if (!q.From.IsZero() && ts.Before(q.From)) || (!q.To.IsZero() && ts.After(q.To)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] > ids[j] })
+	return ids
+}
+
+func (idx *searchIndex) docsWithTerm(term string) map[int]bool {
+	ids := make(map[int]bool)
+	for id := range idx.postings[term] {
+		ids[id] = true
+	}
+	return ids
+}
+
+// docsWithPhrase finds entries where the terms appear consecutively
+func (idx *searchIndex) docsWithPhrase(phrase []string) map[int]bool {
+	ids := make(map[int]bool)
+	if len(phrase) == 0 {
+		return ids
+	}
+
+	for id, positions := range idx.postings[phrase[0]] {
+		for _, start := range positions {
+			if idx.phraseAt(id, phrase, start) {
+				ids[id] = true
+				break
+			}
+		}
+	}
+	return ids
+}
+
+func (idx *searchIndex) phraseAt(id int, phrase []string, start int) bool {
+	terms := idx.docs[id].terms
+	if start+len(phrase) > len(terms) {
+		return false
+	}
+	for i, term := range phrase {
+		if terms[start+i] != term {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSearchQuery parses q with "quoted phrases", prefix* terms and plain terms
+func parseSearchQuery(q string) SearchQuery {
+	var query SearchQuery
+
+	parts := strings.Split(q, `"`)
+	for i, part := range parts {
+		if i%2 == 1 {
+			if phrase := tokenize(part); len(phrase) > 0 {
+				query.Phrases = append(query.Phrases, phrase)
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			if strings.HasSuffix(word, "*") {
+				if terms := tokenize(word); len(terms) > 0 {
+					query.Prefixes = append(query.Prefixes, terms[0])
+				}
+				continue
+			}
+			query.Terms = append(query.Terms, tokenize(word)...)
+		}
+	}
+	return query
+}
+
+// parseSearchPaging reads from, to, limit and offset into the query
+func parseSearchPaging(query *SearchQuery, get func(string) string) error {
+	var err error
+	if v := get("from"); v != "" {
+		if query.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return errors.New("from must be an RFC 3339 time")
+		}
+	}
+	if v := get("to"); v != "" {
+		if query.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return errors.New("to must be an RFC 3339 time")
+		}
+	}
+
+	query.Limit = searchDefaultLimit
+	if v := get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 1 {
+			return errors.New("limit must be a positive integer")
+		}
+		if query.Limit > searchMaxLimit {
+			query.Limit = searchMaxLimit
+		}
+	}
+	if v := get("offset"); v != "" {
+		if query.Offset, err = strconv.Atoi(v); err != nil || query.Offset < 0 {
+			return errors.New("offset must be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+// indexRecord keeps the index in step with a newly appended log record
+func (s *TrustDiaryService) indexRecord(record DiaryEntry) {
+	switch record.Kind {
+	case "":
+		s.search.put(record.ID, record.Content, record.Timestamp)
+	case KindEdit:
+		if ts, ok := s.search.timestampOf(record.Target); ok {
+			s.search.put(record.Target, record.Content, ts)
+		}
+	case KindDelete:
+		s.search.remove(record.Target)
+	}
+}
+
+// rebuildSearchIndex indexes the current revision of every live entry
+func (s *TrustDiaryService) rebuildSearchIndex() {
+	s.search = newSearchIndex()
+	for _, entry := range s.currentEntries() {
+		s.search.put(entry.ID, entry.Content, entry.Timestamp)
+	}
+}
+
+// runSearch executes a query and returns one page of current entries
+func (s *TrustDiaryService) runSearch(query SearchQuery) SearchResult {
+	ids := s.search.search(query)
+
+	result := SearchResult{
+		Total:   len(ids),
+		Offset:  query.Offset,
+		Limit:   query.Limit,
+		Entries: []DiaryEntry{},
+	}
+	if query.Offset >= len(ids) {
+		return result
+	}
+	end := query.Offset + query.Limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+	page := ids[query.Offset:end]
+
+	byID := make(map[int]DiaryEntry)
+	for _, entry := range s.currentEntries() {
+		byID[entry.ID] = entry
+	}
+	for _, id := range page {
+		if entry, ok := byID[id]; ok {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result
+}
+
+// handleSearch serves GET /api/search
+func (s *TrustDiaryService) handleSearch(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := parseSearchQuery(params.Get("q"))
+	if err := parseSearchPaging(&query, params.Get); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.runSearch(query))
+}
+
+// handlePeerSearch answers a search message from a reader
+func (s *TrustDiaryService) handlePeerSearch(peerID string, msg map[string]interface{}) {
+	q, _ := msg["q"].(string)
+	query := parseSearchQuery(q)
+
+	err := parseSearchPaging(&query, func(key string) string {
+		switch v := msg[key].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.Itoa(int(v))
+		}
+		return ""
+	})
+	if err != nil {
+		s.sendError(peerID, "search", err)
+		return
+	}
+
+	s.sendToPeer(peerID, map[string]interface{}{
+		"type":   "search-result",
+		"q":      q,
+		"result": s.runSearch(query),
+	})
+}
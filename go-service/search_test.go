@@ -0,0 +1,34 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want SearchQuery
+	}{
+		{"", SearchQuery{}},
+		{"Garden tomatoes", SearchQuery{Terms: []string{"garden", "tomatoes"}}},
+		{"tom*", SearchQuery{Prefixes: []string{"tom"}}},
+		{`"Blue Sky" rain`, SearchQuery{
+			Terms:   []string{"rain"},
+			Phrases: [][]string{{"blue", "sky"}},
+		}},
+		{`walk "in the park" dog* "" cat`, SearchQuery{
+			Terms:    []string{"walk", "cat"},
+			Prefixes: []string{"dog"},
+			Phrases:  [][]string{{"in", "the", "park"}},
+		}},
+		{"don't stop", SearchQuery{Terms: []string{"don", "t", "stop"}}},
+		{`"unterminated phrase`, SearchQuery{Phrases: [][]string{{"unterminated", "phrase"}}}},
+		{"* ...", SearchQuery{}},
+	}
+	for _, tt := range tests {
+		if got := parseSearchQuery(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Storage backends
+const (
+	StorageJSON = "json"
+	StorageBolt = "bolt"
+)
+
+// Store persists the entry log, the trusted users and invites. Every method is
+// atomic: a crash leaves either the previous or the new state on disk
+type Store interface {
+	// LoadEntries returns the whole entry log, empty if nothing is stored. A
+	// plaintext log is returned as is and only sealed by the next write, so
+	// the caller can check it before anything is rewritten
+	LoadEntries() ([]DiaryEntry, error)
+	// ReadEntries returns the log exactly as stored now, bypassing any cache
+	// and migrating nothing; it returns errUnsealedEntries along with the
+	// entries if they were found in plaintext
+	ReadEntries() ([]DiaryEntry, error)
+	// AppendEntry adds one record to the end of the log
+	AppendEntry(entry DiaryEntry) error
+	// ReplaceEntries overwrites the log, used for migrations and quarantine
+	ReplaceEntries(entries []DiaryEntry) error
+	// LoadTrustedUsers returns every trusted user
+	LoadTrustedUsers() ([]TrustedUser, error)
+	// SaveTrustedUsers overwrites the trusted user list
+	SaveTrustedUsers(users []TrustedUser) error
+	// LoadInvites returns every invite, including used and revoked ones
+	LoadInvites() ([]Invite, error)
+	// SaveInvites overwrites the invite list
+	SaveInvites(invites []Invite) error
+	// Close releases the backend
+	Close() error
+}
+
+// errUnsealedEntries means the stored entry log is plaintext although the
+// store only ever writes it sealed
+var errUnsealedEntries = errors.New("entries are stored unsealed")
+
+// jsonStore keeps entries.json, trusted.json and invites.json as encrypted
+// JSON files
+type jsonStore struct {
+	cipher      *storageCipher
+	entriesPath string
+	trustedPath string
+	invitesPath string
+
+	mu      sync.Mutex
+	entries []DiaryEntry
+}
+
+// newJSONStore opens the JSON file store in dataDir
+func newJSONStore(dataDir string, cipher *storageCipher) *jsonStore {
+	return &jsonStore{
+		cipher:      cipher,
+		entriesPath: filepath.Join(dataDir, "entries.json"),
+		trustedPath: filepath.Join(dataDir, "trusted.json"),
+		invitesPath: filepath.Join(dataDir, "invites.json"),
+	}
+}
+
+func (j *jsonStore) LoadEntries() ([]DiaryEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var entries []DiaryEntry
+	if _, err := j.cipher.decodeFile(j.entriesPath, &entries); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse entries: %w", err)
+	}
+	j.entries = entries
+	return append([]DiaryEntry(nil), entries...), nil
+}
+
+func (j *jsonStore) ReadEntries() ([]DiaryEntry, error) {
+	var entries []DiaryEntry
+	plaintext, err := j.cipher.decodeFile(j.entriesPath, &entries)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse entries: %w", err)
+	}
+	if plaintext {
+		return entries, errUnsealedEntries
+	}
+	return entries, nil
+}
+
+func (j *jsonStore) AppendEntry(entry DiaryEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := append(append([]DiaryEntry(nil), j.entries...), entry)
+	if err := j.cipher.writeFile(j.entriesPath, entries); err != nil {
+		return fmt.Errorf("failed to save entries: %w", err)
+	}
+	j.entries = entries
+	return nil
+}
+
+func (j *jsonStore) ReplaceEntries(entries []DiaryEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries = append([]DiaryEntry(nil), entries...)
+	if err := j.cipher.writeFile(j.entriesPath, entries); err != nil {
+		return fmt.Errorf("failed to save entries: %w", err)
+	}
+	j.entries = entries
+	return nil
+}
+
+func (j *jsonStore) LoadTrustedUsers() ([]TrustedUser, error) {
+	var trusted []TrustedUser
+	if err := j.cipher.readFile(j.trustedPath, &trusted); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse trusted users: %w", err)
+	}
+	return trusted, nil
+}
+
+func (j *jsonStore) SaveTrustedUsers(users []TrustedUser) error {
+	if err := j.cipher.writeFile(j.trustedPath, users); err != nil {
+		return fmt.Errorf("failed to save trusted users: %w", err)
+	}
+	return nil
+}
+
+func (j *jsonStore) LoadInvites() ([]Invite, error) {
+	var invites []Invite
+	if err := j.cipher.readFile(j.invitesPath, &invites); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to parse invites: %w", err)
+	}
+	return invites, nil
+}
+
+func (j *jsonStore) SaveInvites(invites []Invite) error {
+	if err := j.cipher.writeFile(j.invitesPath, invites); err != nil {
+		return fmt.Errorf("failed to save invites: %w", err)
+	}
+	return nil
+}
+
+// setCipher switches the cipher used for later reads and writes
+func (j *jsonStore) setCipher(c *storageCipher) {
+	j.mu.Lock()
+	j.cipher = c
+	j.mu.Unlock()
+}
+
+func (j *jsonStore) Close() error {
+	return nil
+}
+
+// openStore opens the configured backend, importing the JSON files into a
+// fresh database
+func (s *TrustDiaryService) openStore() (Store, error) {
+	jsonFiles := newJSONStore(s.dataDir, s.cipher)
+
+	switch s.storageBackend {
+	case "", StorageJSON:
+		return jsonFiles, nil
+	case StorageBolt:
+		db, err := openBoltStore(filepath.Join(s.dataDir, "diary.db"), s.cipher)
+		if err != nil {
+			return nil, err
+		}
+		if err := importStore(db, jsonFiles); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to import JSON data: %w", err)
+		}
+		return db, nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", s.storageBackend)
+}
+
+// importStore copies entries, trusted users and invites from src into an
+// empty dst
+func importStore(dst, src Store) error {
+	existing, err := dst.LoadEntries()
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	entries, err := src.LoadEntries()
+	if err != nil {
+		return err
+	}
+	trusted, err := src.LoadTrustedUsers()
+	if err != nil {
+		return err
+	}
+	invites, err := src.LoadInvites()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && len(trusted) == 0 && len(invites) == 0 {
+		return nil
+	}
+
+	if err := dst.ReplaceEntries(entries); err != nil {
+		return err
+	}
+	if err := dst.SaveTrustedUsers(trusted); err != nil {
+		return err
+	}
+	if err := dst.SaveInvites(invites); err != nil {
+		return err
+	}
+
+	log.Printf("📦 Imported %d entries and %d trusted users into the database", len(entries), len(trusted))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testStores returns each backend over an empty directory
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	c := testCipher(t)
+	db, err := openBoltStore(filepath.Join(t.TempDir(), "diary.db"), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return map[string]Store{
+		StorageJSON: newJSONStore(t.TempDir(), c),
+		StorageBolt: db,
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			if entries, err := store.LoadEntries(); err != nil || len(entries) != 0 {
+				t.Fatalf("empty store: %v, %v", entries, err)
+			}
+
+			want := []DiaryEntry{{ID: 1, Content: "one"}, {ID: 2, Content: "two"}}
+			for _, entry := range want {
+				if err := store.AppendEntry(entry); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := store.LoadEntries()
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Fatalf("after append got %+v, %v", got, err)
+			}
+			if read, err := store.ReadEntries(); err != nil || !reflect.DeepEqual(read, want) {
+				t.Fatalf("ReadEntries got %+v, %v", read, err)
+			}
+
+			replaced := []DiaryEntry{{ID: 3, Content: "three"}}
+			if err := store.ReplaceEntries(replaced); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.LoadEntries(); err != nil || !reflect.DeepEqual(got, replaced) {
+				t.Fatalf("after replace got %+v, %v", got, err)
+			}
+
+			users := []TrustedUser{{PublicKey: "pk", Name: "Alice", Permissions: []string{PermRead}}}
+			if err := store.SaveTrustedUsers(users); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := store.LoadTrustedUsers(); err != nil || !reflect.DeepEqual(got, users) {
+				t.Fatalf("trusted users got %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestImportStore(t *testing.T) {
+	stores := testStores(t)
+	src, dst := stores[StorageJSON], stores[StorageBolt]
+
+	entries := []DiaryEntry{{ID: 1, Content: "imported"}}
+	if err := src.ReplaceEntries(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := importStore(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dst.LoadEntries(); err != nil || !reflect.DeepEqual(got, entries) {
+		t.Fatalf("imported %+v, %v", got, err)
+	}
+
+	// A database that already has entries is never overwritten
+	if err := src.ReplaceEntries([]DiaryEntry{{ID: 9, Content: "newer"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := importStore(dst, src); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := dst.LoadEntries(); !reflect.DeepEqual(got, entries) {
+		t.Fatalf("second import changed the database: %+v", got)
+	}
+}
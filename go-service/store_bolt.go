@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketEntries = []byte("entries")
+	bucketTrusted = []byte("trusted")
+	bucketInvites = []byte("invites")
+)
+
+// boltStore keeps the entry log and trusted users in a bbolt database; each
+// value is sealed with the storage cipher like the JSON files
+type boltStore struct {
+	db     *bolt.DB
+	cipher *storageCipher
+}
+
+// openBoltStore opens or creates the database at path
+func openBoltStore(path string, cipher *storageCipher) (*boltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketEntries, bucketTrusted, bucketInvites} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &boltStore{db: db, cipher: cipher}, nil
+}
+
+// entryKey orders entries by ID
+func entryKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func (b *boltStore) LoadEntries() ([]DiaryEntry, error) {
+	var entries []DiaryEntry
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketEntries).ForEach(func(k, v []byte) error {
+			var entry DiaryEntry
+			if err := b.cipher.openJSON(v, &entry); err != nil {
+				return fmt.Errorf("entry %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load entries: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadEntries is LoadEntries: the bolt store keeps no cache
+func (b *boltStore) ReadEntries() ([]DiaryEntry, error) {
+	return b.LoadEntries()
+}
+
+func (b *boltStore) AppendEntry(entry DiaryEntry) error {
+	value, err := b.cipher.sealJSON(entry)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketEntries).Put(entryKey(entry.ID), value)
+	})
+}
+
+func (b *boltStore) ReplaceEntries(entries []DiaryEntry) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucketEntries); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(bucketEntries)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			value, err := b.cipher.sealJSON(entry)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(entryKey(entry.ID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) LoadTrustedUsers() ([]TrustedUser, error) {
+	var users []TrustedUser
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketTrusted).ForEach(func(k, v []byte) error {
+			var user TrustedUser
+			if err := b.cipher.openJSON(v, &user); err != nil {
+				return fmt.Errorf("trusted user %s: %w", k, err)
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load trusted users: %w", err)
+	}
+	return users, nil
+}
+
+func (b *boltStore) SaveTrustedUsers(users []TrustedUser) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucketTrusted); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(bucketTrusted)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			value, err := b.cipher.sealJSON(user)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(user.PublicKey), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) LoadInvites() ([]Invite, error) {
+	var invites []Invite
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketInvites).ForEach(func(k, v []byte) error {
+			var invite Invite
+			if err := b.cipher.openJSON(v, &invite); err != nil {
+				return fmt.Errorf("invite %s: %w", k, err)
+			}
+			invites = append(invites, invite)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load invites: %w", err)
+	}
+	return invites, nil
+}
+
+func (b *boltStore) SaveInvites(invites []Invite) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(bucketInvites); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(bucketInvites)
+		if err != nil {
+			return err
+		}
+		for _, invite := range invites {
+			value, err := b.cipher.sealJSON(invite)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(invite.ID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// setCipher switches the cipher used for later reads and writes
+func (b *boltStore) setCipher(c *storageCipher) {
+	b.cipher = c
+}
+
+func (b *boltStore) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log"
+)
+
+// CapabilitySync means the reader fetches entries with sync messages instead
+// of receiving a full dump after authentication
+const CapabilitySync = "sync"
+
+const (
+	// syncBatchSize is the default number of records per sync-batch frame
+	syncBatchSize = 100
+	// syncMaxBatch caps the batch size a reader may ask for
+	syncMaxBatch = 500
+)
+
+// entriesSince returns a copy of every log record after the given ID; record
+// IDs are log positions, so the cursor is simply an index into the log
+func (s *TrustDiaryService) entriesSince(cursor int) []DiaryEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if cursor < 0 {
+		cursor = 0
+	}
+	if cursor >= len(s.entries) {
+		return nil
+	}
+
+	missing := make([]DiaryEntry, len(s.entries)-cursor)
+	copy(missing, s.entries[cursor:])
+	return missing
+}
+
+// handleSyncRequest sends the records a reader is missing in batched frames,
+// followed by a sync-end marker carrying the new cursor and the signed head
+func (s *TrustDiaryService) handleSyncRequest(peerID string, msg map[string]interface{}) {
+	since, _ := msg["since"].(float64)
+	cursor := int(since)
+
+	batchSize := syncBatchSize
+	if limit, ok := msg["limit"].(float64); ok && limit > 0 {
+		batchSize = int(limit)
+		if batchSize > syncMaxBatch {
+			batchSize = syncMaxBatch
+		}
+	}
+
+	missing := s.entriesSince(cursor)
+	for start := 0; start < len(missing); start += batchSize {
+		end := start + batchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		s.sendToPeer(peerID, map[string]interface{}{
+			"type":    "sync-batch",
+			"entries": batch,
+			"cursor":  batch[len(batch)-1].ID,
+			"more":    end < len(missing),
+		})
+	}
+
+	if len(missing) > 0 {
+		cursor = missing[len(missing)-1].ID
+	}
+
+	s.sendToPeer(peerID, map[string]interface{}{
+		"type":   "sync-end",
+		"cursor": cursor,
+		"count":  len(missing),
+		"head":   s.chainHead(),
+	})
+
+	log.Printf("🔄 Synced %d records to %s (cursor %d)", len(missing), peerID[:8], cursor)
+}